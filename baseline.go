@@ -0,0 +1,140 @@
+package igmigrator
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// Baseline records migrations of the directory up to the version as applied without running them,
+// so an existing database can be brought under migration.
+//
+// Directory path is relative to the migrations directory, like `/` or `/test`.
+// It fails if the directory already has applied versions.
+func Baseline(ctx context.Context, db DB, cnf *Config, directoryPath string, version int) (*MigrateResult, error) {
+	var result *MigrateResult
+
+	err := inTx(ctx, db, func(tx Transaction) error {
+		var err error
+		result, err = BaselineInTx(ctx, tx, cnf, directoryPath, version)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// BaselineInTx is the same as Baseline but operates on the given transaction.
+func BaselineInTx(ctx context.Context, tx Transaction, cnf *Config, directoryPath string, version int) (*MigrateResult, error) {
+	migration, err := newMigrator(ctx, tx, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migration.prepareDB(ctx); err != nil {
+		return nil, err
+	}
+
+	dir := cleanPath(directoryPath)
+
+	applied, err := migration.GetAppliedVersions(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(applied) > 0 {
+		return nil, fmt.Errorf("baseline of %s: migration table already has version %d", dir, applied[len(applied)-1])
+	}
+
+	newVersion, records, err := migration.baselineDir(ctx, dir, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MigrateResult{
+		Path:    map[string]MigrateResultVersion{dir: {NewVersion: newVersion}},
+		Records: records,
+	}, nil
+}
+
+// baselineDir records migrations of the directory with a version at or below the baseline version
+// and returns the highest recorded version with the added rows.
+//
+// Files are recorded with their checksum, so changes of them are still detected.
+// Rows are not added to Records of Migrate, those files are not run.
+func (m *Migrator) baselineDir(ctx context.Context, dir string, version int) (int, []MigrationRecord, error) {
+	files, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), -1)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var records []MigrationRecord
+
+	lastVersion, recorded := 0, false
+	for _, file := range files {
+		fileVersion := VersionFromFile(file)
+		if fileVersion > version {
+			break
+		}
+
+		// Only first file of a version is recorded.
+		if recorded && fileVersion == lastVersion {
+			continue
+		}
+
+		fileChecksum, err := m.fileChecksum(dir, file)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		record := MigrationRecord{Path: dir, Version: fileVersion, Checksum: fileChecksum, File: path.Join(dir, file), Name: file}
+		if err := m.insertRecord(ctx, &record); err != nil {
+			return 0, nil, fmt.Errorf("failed to record baseline version %d of %s: %w", fileVersion, dir, err)
+		}
+
+		records = append(records, record)
+		lastVersion, recorded = fileVersion, true
+	}
+
+	m.Logger.Info("baseline recorded", "path", dir, "baseline_version", version, "version", lastVersion)
+
+	return lastVersion, records, nil
+}
+
+// baselineEmpty records Config.BaselineVersion for all directories if the migration table is empty.
+func (m *Migrator) baselineEmpty(ctx context.Context) error {
+	empty, err := m.migrationTableEmpty(ctx, true)
+	if err != nil || !empty {
+		return err
+	}
+
+	dirs, err := m.GetDirs()
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		if _, _, err := m.baselineDir(ctx, dir, m.Cnf.BaselineVersion); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrationTableEmpty reports whether the migration table has no versions, a not existing table is empty.
+func (m *Migrator) migrationTableEmpty(ctx context.Context, tableExists bool) (bool, error) {
+	if !tableExists {
+		return true, nil
+	}
+
+	var count int
+	if err := m.Tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+m.MigrationTable()).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
@@ -0,0 +1,203 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestBaseline(t *testing.T) {
+	tests := []struct {
+		name    string
+		applied []int
+		version int
+		want    int
+		wantErr string
+	}{
+		{
+			name:    "up to version",
+			version: 2,
+			want:    2,
+		},
+		{
+			name:    "above all files",
+			version: 100,
+			want:    3,
+		},
+		{
+			name:    "already applied",
+			applied: []int{1},
+			version: 2,
+			wantErr: "baseline of /: migration table already has version 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			versions := sqlmock.NewRows([]string{"version"})
+			for _, version := range tt.applied {
+				versions.AddRow(version)
+			}
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			expectPrepareDB(mck, "migration")
+			mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versions)
+
+			if tt.wantErr != "" {
+				mck.ExpectRollback()
+			} else {
+				expectCurrentUser(mck)
+
+				for version := 1; version <= tt.want; version++ {
+					mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", version, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+				}
+
+				mck.ExpectCommit()
+			}
+
+			result, err := Baseline(context.Background(), db, &Config{MigrationsDir: testdata.Path("baseline")}, "/", tt.version)
+			require.NoError(t, mck.ExpectationsWereMet())
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: tt.want}, result.Path["/"])
+		})
+	}
+}
+
+func TestMigrate_BaselineVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		applied  []int
+		baseline bool
+	}{
+		{
+			name:     "empty table",
+			applied:  []int{1, 2},
+			baseline: true,
+		},
+		{
+			name:    "not empty table",
+			count:   2,
+			applied: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			versions := sqlmock.NewRows([]string{"version"})
+			for _, version := range tt.applied {
+				versions.AddRow(version)
+			}
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			expectPrepareDB(mck, "migration")
+			mck.ExpectQuery("SELECT COUNT\\(\\*\\) FROM migration").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tt.count))
+
+			if tt.baseline {
+				expectCurrentUser(mck)
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versions)
+			mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+			mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+			mck.ExpectExec("ALTER TABLE accounts ADD COLUMN name").WillReturnResult(sqlmock.NewResult(0, 0))
+
+			if !tt.baseline {
+				expectCurrentUser(mck)
+			}
+
+			mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 3, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			mck.ExpectCommit()
+
+			result, err := Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("baseline"), BaselineVersion: 2})
+			require.NoError(t, err)
+			assert.Equal(t, MigrateResultVersion{PrevVersion: 2, NewVersion: 3}, result.Path["/"])
+			// Baseline versions are not run, only the applied file is reported.
+			require.Len(t, result.Records, 1)
+			assert.Equal(t, 3, result.Records[0].Version)
+			require.NoError(t, mck.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPlan_BaselineVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		init  func(mck sqlmock.Sqlmock)
+		files []PlannedMigration
+		want  string
+	}{
+		{
+			name: "no migration table",
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT to_regclass\\('migration'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			files: []PlannedMigration{
+				{File: "/1_create_accounts.sql", Name: "1_create_accounts.sql", Version: 1, Baseline: true},
+				{File: "/2_create_users.sql", Name: "2_create_users.sql", Version: 2, Baseline: true},
+				{File: "/3_add_accounts_name.sql", Name: "3_add_accounts_name.sql", Version: 3},
+			},
+			want: "/: 0 -> 3\n  1\t/1_create_accounts.sql\tbaseline\n  2\t/2_create_users.sql\tbaseline\n  3\t/3_add_accounts_name.sql\n",
+		},
+		{
+			name: "not empty table",
+			init: func(mck sqlmock.Sqlmock) {
+				expectMigrationTable(mck, "migration")
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) FROM migration").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+			},
+			files: []PlannedMigration{
+				{File: "/2_create_users.sql", Name: "2_create_users.sql", Version: 2},
+				{File: "/3_add_accounts_name.sql", Name: "3_add_accounts_name.sql", Version: 3},
+			},
+			want: "/: 1 -> 3\n  2\t/2_create_users.sql\n  3\t/3_add_accounts_name.sql\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			tt.init(mck)
+			mck.ExpectRollback()
+
+			plan, err := Plan(context.Background(), db, &Config{MigrationsDir: testdata.Path("baseline"), BaselineVersion: 2})
+			require.NoError(t, err)
+			require.NoError(t, mck.ExpectationsWereMet())
+
+			assert.Equal(t, tt.files, plan.Dirs[0].Files)
+			assert.Equal(t, tt.want, plan.String())
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package igmigrator
+
+import (
+	"context"
+	"path"
+)
+
+// SQL callback file names, callbacks of a directory run in the migration transaction when it has pending migrations.
+const (
+	CallbackBeforeAll  = "_before_all.sql"
+	CallbackBeforeEach = "_before_each.sql"
+	CallbackAfterEach  = "_after_each.sql"
+	CallbackAfterAll   = "_after_all.sql"
+)
+
+// Callbacks are SQL callback files of a directory.
+// Files are relative to the migrations directory, like `/test/_after_all.sql`, and empty if the directory does not have them.
+type Callbacks struct {
+	BeforeAll  string
+	BeforeEach string
+	AfterEach  string
+	AfterAll   string
+}
+
+// GetCallbacks returns SQL callback files of the directory relative to the migrations directory.
+func (m *Migrator) GetCallbacks(directoryPath string) (Callbacks, error) {
+	var callbacks Callbacks
+
+	files, err := m.readdir(path.Join(m.Cnf.MigrationsDir, directoryPath))
+	if err != nil {
+		return callbacks, err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		fileName := path.Join(directoryPath, file.Name())
+
+		switch file.Name() {
+		case CallbackBeforeAll:
+			callbacks.BeforeAll = fileName
+		case CallbackBeforeEach:
+			callbacks.BeforeEach = fileName
+		case CallbackAfterEach:
+			callbacks.AfterEach = fileName
+		case CallbackAfterAll:
+			callbacks.AfterAll = fileName
+		}
+	}
+
+	return callbacks, nil
+}
+
+// getCallbacks returns callbacks of the directory, read once per Migrator.
+func (m *Migrator) getCallbacks(directoryPath string) (Callbacks, error) {
+	if callbacks, ok := m.callbacks[directoryPath]; ok {
+		return callbacks, nil
+	}
+
+	callbacks, err := m.GetCallbacks(directoryPath)
+	if err != nil {
+		return callbacks, err
+	}
+
+	if m.callbacks == nil {
+		m.callbacks = make(map[string]Callbacks)
+	}
+
+	m.callbacks[directoryPath] = callbacks
+
+	return callbacks, nil
+}
+
+// isCallback reports whether the file name is a SQL callback file.
+func isCallback(name string) bool {
+	switch name {
+	case CallbackBeforeAll, CallbackBeforeEach, CallbackAfterEach, CallbackAfterAll:
+		return true
+	}
+
+	return false
+}
+
+// runCallback executes the callback file relative to the migrations directory, no-op if fileName is empty.
+func (m *Migrator) runCallback(ctx context.Context, fileName string) error {
+	if fileName == "" {
+		return nil
+	}
+
+	filePath := path.Join(m.Cnf.MigrationsDir, fileName)
+	if _, _, err := m.migrateFile(ctx, filePath); err != nil {
+		return m.newMigrationError(ctx, fileName, 0, err)
+	}
+
+	m.Logger.Info("success run callback", "callback_path", filePath)
+
+	return nil
+}
+
+// migrateDir runs migrations and then repeatable migrations of the directory between its before all and after all callbacks.
+//
+// Before all callback is skipped if the directory continues after a non-transactional migration,
+// repeatable migrations and after all callback are skipped if it stops at one.
+func (m *Migrator) migrateDir(ctx context.Context, dir string, migrations, repeatables []string, lastVersion int, continued bool) (int, error) {
+	callbacks, err := m.getCallbacks(dir)
+	if err != nil {
+		return lastVersion, err
+	}
+
+	if !continued {
+		if err := m.runCallback(ctx, callbacks.BeforeAll); err != nil {
+			return lastVersion, err
+		}
+	}
+
+	newVersion, err := m.MigrateMultiple(ctx, migrations, lastVersion)
+	if err != nil {
+		return lastVersion, err
+	}
+
+	if m.nonTransactional != "" {
+		return newVersion, nil
+	}
+
+	if err := m.migrateRepeatables(ctx, repeatables); err != nil {
+		return lastVersion, err
+	}
+
+	if err := m.runCallback(ctx, callbacks.AfterAll); err != nil {
+		return lastVersion, err
+	}
+
+	return newVersion, nil
+}
@@ -0,0 +1,129 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrate_Callbacks(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("SET LOCAL role migrator").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("CREATE TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("GRANT SELECT ON ALL TABLES IN SCHEMA public TO reader").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectCommit()
+
+	result, err := Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("callbacks")})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 2}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrateTo_Callbacks(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("INSERT INTO deploys").WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("SET LOCAL role migrator").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("INSERT INTO audit").WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("GRANT SELECT ON ALL TABLES IN SCHEMA public TO reader").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectCommit()
+
+	// Going up runs hooks and callback files like Migrate, files above the target are not run.
+	result, err := MigrateTo(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("callbacks"),
+		BeforeAll: func(ctx context.Context, tx Transaction) error {
+			_, err := tx.ExecContext(ctx, "INSERT INTO deploys")
+
+			return err
+		},
+	}, "/", 1)
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 1}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestPlan_Callbacks(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.ExpectBegin()
+	expectMigrationTable(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+	mck.ExpectRollback()
+
+	plan, err := Plan(context.Background(), db, &Config{MigrationsDir: testdata.Path("callbacks")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, Callbacks{
+		BeforeAll: "/_before_all.sql",
+		AfterEach: "/_after_each.sql",
+		AfterAll:  "/_after_all.sql",
+	}, plan.Dirs[0].Callbacks)
+	assert.Equal(t, `/: 1 -> 2
+  before all	/_before_all.sql
+  2	/2_create_users.sql
+  after each	/_after_each.sql
+  after all	/_after_all.sql
+`, plan.String())
+}
+
+func TestMigrator_RunCallback_MigrationError(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{Tx: db, Cnf: &Config{MigrationsDir: testdata.Path("callbacks")}, Logger: logz.AdapterNoop{}}
+
+	driverErr := errors.New(`role "migrator" does not exist`)
+	mck.ExpectExec("SET LOCAL role migrator").WillReturnError(driverErr)
+
+	err = m.runCallback(context.Background(), "/_before_all.sql")
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	var migrationErr *MigrationError
+	require.ErrorAs(t, err, &migrationErr)
+	assert.Equal(t, "/", migrationErr.Path)
+	assert.Equal(t, "SET LOCAL role migrator;\n", migrationErr.Statement)
+	assert.ErrorIs(t, err, driverErr)
+	assert.EqualError(t, err, `failed callback testdata/callbacks/_before_all.sql: role "migrator" does not exist`)
+}
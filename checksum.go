@@ -0,0 +1,130 @@
+package igmigrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path"
+)
+
+// ChecksumMismatch describes an applied migration file which has been changed after it was applied.
+type ChecksumMismatch struct {
+	// Path is the directory of the migration, like `/` or `/test`.
+	Path    string
+	File    string
+	Name    string
+	Version int
+	// Applied is the checksum recorded in migration table.
+	Applied string
+	// Current is the checksum of the file now.
+	Current string
+}
+
+func (c ChecksumMismatch) String() string {
+	return fmt.Sprintf("checksum mismatch on %s version %d: applied %s, current %s", c.File, c.Version, c.Applied, c.Current)
+}
+
+// VerifyChecksums re-hashes applied migration files of the directory and returns files with changed content.
+//
+// Versions without recorded checksum and applied versions without file are not reported.
+func (m *Migrator) VerifyChecksums(ctx context.Context, directoryPath string) ([]ChecksumMismatch, error) {
+	applied, err := m.GetAppliedChecksums(ctx, directoryPath)
+	if err != nil || len(applied) == 0 {
+		return nil, err
+	}
+
+	files, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, directoryPath), -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []ChecksumMismatch
+	for _, file := range files {
+		version := VersionFromFile(file)
+
+		appliedChecksum, ok := applied[version]
+		if !ok {
+			continue
+		}
+
+		// Only first file of a version is checked.
+		delete(applied, version)
+
+		filePath := path.Join(m.Cnf.MigrationsDir, directoryPath, file)
+
+		content, err := m.readFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := m.contentChecksum(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+
+		if current != appliedChecksum {
+			mismatches = append(mismatches, ChecksumMismatch{
+				Path:    directoryPath,
+				File:    path.Join(directoryPath, file),
+				Name:    file,
+				Version: version,
+				Applied: appliedChecksum,
+				Current: current,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// GetAppliedChecksums returns recorded checksums of the directory by version.
+func (m *Migrator) GetAppliedChecksums(ctx context.Context, directoryPath string) (map[int]string, error) {
+	rows, err := m.Tx.QueryContext(ctx, "SELECT version, checksum FROM "+m.MigrationTable()+
+		" WHERE path = "+m.Dialect().Placeholder(1)+" AND checksum IS NOT NULL", directoryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := make(map[int]string)
+	for rows.Next() {
+		var (
+			version  int
+			checksum sql.NullString
+		)
+
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+
+		checksums[version] = checksum.String
+	}
+
+	return checksums, rows.Err()
+}
+
+// contentChecksum returns checksum of the migration file content.
+//
+// Checksum of a template is of the rendered SQL, so changes of included files, Config.Values
+// and environment variables used by the template are detected like changes of the file.
+func (m *Migrator) contentChecksum(filePath string, content []byte) (string, error) {
+	if !isTemplate(filePath) {
+		return checksum(content), nil
+	}
+
+	rendered, err := m.render(filePath, content)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", filePath, err)
+	}
+
+	return checksum([]byte(rendered)), nil
+}
+
+// checksum returns hex encoded SHA-256 of the migration file content.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
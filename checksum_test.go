@@ -0,0 +1,44 @@
+package igmigrator
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrator_VerifyChecksums(t *testing.T) {
+	content, err := os.ReadFile(testdata.Path("normal", "1_install_table.sql"))
+	require.NoError(t, err)
+
+	changed, err := os.ReadFile(testdata.Path("normal", "2_install_pos.sql"))
+	require.NoError(t, err)
+
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").
+		WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(1, checksum(content)).AddRow(2, "abc"))
+
+	m := Migrator{
+		Tx:  db,
+		Cnf: &Config{MigrationsDir: testdata.Path("normal"), MigrationTable: "migration"},
+	}
+
+	mismatches, err := m.VerifyChecksums(context.Background(), "/")
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, []ChecksumMismatch{
+		{Path: "/", File: "/2_install_pos.sql", Name: "2_install_pos.sql", Version: 2, Applied: "abc", Current: checksum(changed)},
+	}, mismatches)
+	assert.Equal(t, "checksum mismatch on /2_install_pos.sql version 2: applied abc, current "+checksum(changed), mismatches[0].String())
+}
@@ -0,0 +1,489 @@
+// Command igmigrator runs igmigrator migrations without building a service around the library.
+//
+//	igmigrator [flags] up|status|plan|validate
+//	igmigrator [flags] new NAME
+//	igmigrator [flags] baseline VERSION [PATH]
+//	igmigrator [flags] repair OPERATION [ARGS]
+//
+// Flags can also be set with environment variables, flags have precedence.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/microsoft/go-mssqldb"
+	"github.com/worldline-go/logz"
+	_ "modernc.org/sqlite"
+
+	"github.com/worldline-go/igmigrator/v2"
+)
+
+// Exit codes of the command.
+const (
+	exitOK = iota
+	// exitError is returned when database or migration fails.
+	exitError
+	// exitUsage is returned on wrong flags or subcommand.
+	exitUsage
+	// exitIssues is returned by validate when any issue is found.
+	exitIssues
+)
+
+const usage = `Usage: igmigrator [flags] <command>
+
+Commands:
+  up          run pending migrations
+  status      show applied, pending and orphaned migrations
+  plan        show pending migrations without running them
+  validate    check migration files against the migration table
+  new NAME    create a new migration file with the next version
+  baseline VERSION [PATH]
+              record migrations of PATH (default /) up to VERSION as applied without running them
+  repair mark-applied PATH VERSION | unmark PATH VERSION | checksums [PATH] | orphaned-paths
+              fix the migration table without running migrations
+
+Flags:
+`
+
+// dialects are the supported databases with the name of their registered driver.
+var dialects = map[string]struct {
+	driver  string
+	dialect igmigrator.Dialect
+}{
+	"postgres":  {driver: "pgx", dialect: igmigrator.PostgreSQLDialect{}},
+	"mysql":     {driver: "mysql", dialect: igmigrator.MySQLDialect{}},
+	"sqlite":    {driver: "sqlite", dialect: igmigrator.SQLiteDialect{}},
+	"sqlserver": {driver: "sqlserver", dialect: igmigrator.SQLServerDialect{}},
+}
+
+type options struct {
+	dsn         string
+	dialect     string
+	dir         string
+	schema      string
+	table       string
+	preFolders  string
+	values      string
+	appVersion  string
+	lock        string
+	lockTimeout string
+	stmtTimeout string
+	maxDuration string
+	logLevel    string
+	split       bool
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	opts := options{}
+
+	fs := flag.NewFlagSet("igmigrator", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	fs.StringVar(&opts.dsn, "dsn", os.Getenv("IGMIGRATOR_DSN"), "database connection string [IGMIGRATOR_DSN]")
+	fs.StringVar(&opts.dialect, "dialect", envDefault("IGMIGRATOR_DIALECT", "postgres"), "database, postgres, mysql, sqlite or sqlserver [IGMIGRATOR_DIALECT]")
+	fs.StringVar(&opts.dir, "dir", "", "migrations directory [IGMIGRATOR_MIGRATION_DIR] (default migrations)")
+	fs.StringVar(&opts.schema, "schema", os.Getenv("IGMIGRATOR_SCHEMA"), "schema to run migrations in [IGMIGRATOR_SCHEMA]")
+	fs.StringVar(&opts.table, "table", "", "migration table name [IGMIGRATION_MIGRATION_TABLE] (default migration)")
+	fs.StringVar(&opts.preFolders, "pre-folders", os.Getenv("IGMIGRATOR_PRE_FOLDERS"), "comma separated folders to run first [IGMIGRATOR_PRE_FOLDERS]")
+	fs.StringVar(&opts.values, "values", os.Getenv("IGMIGRATOR_VALUES"), "comma separated KEY=VALUE pairs for migration files [IGMIGRATOR_VALUES]")
+	fs.StringVar(&opts.appVersion, "app-version", os.Getenv("IGMIGRATOR_APP_VERSION"), "application version recorded with applied migrations [IGMIGRATOR_APP_VERSION]")
+	fs.StringVar(&opts.lock, "lock", os.Getenv("IGMIGRATOR_LOCK"), "lock strategy, table or advisory [IGMIGRATOR_LOCK] (default lock of the dialect)")
+	fs.StringVar(&opts.lockTimeout, "lock-timeout", os.Getenv("IGMIGRATOR_LOCK_TIMEOUT"), "maximum wait for the migration lock, like 30s [IGMIGRATOR_LOCK_TIMEOUT]")
+	fs.StringVar(&opts.stmtTimeout, "statement-timeout", os.Getenv("IGMIGRATOR_STATEMENT_TIMEOUT"), "maximum duration of each migration file, like 5m [IGMIGRATOR_STATEMENT_TIMEOUT]")
+	fs.StringVar(&opts.maxDuration, "max-duration", os.Getenv("IGMIGRATOR_MAX_DURATION"), "maximum duration of the whole run, like 30m [IGMIGRATOR_MAX_DURATION]")
+	fs.BoolVar(&opts.split, "split-statements", envBool("IGMIGRATOR_SPLIT_STATEMENTS"), "run statements of migration files one by one [IGMIGRATOR_SPLIT_STATEMENTS]")
+	fs.StringVar(&opts.logLevel, "log-level", "info", "log level")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+
+		return exitUsage
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+
+		return exitUsage
+	}
+
+	logz.InitializeLog(logz.WithLevel(opts.logLevel))
+
+	cnf, err := opts.config()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+
+		return exitUsage
+	}
+
+	command, commandArgs := fs.Arg(0), fs.Args()[1:]
+
+	if command == "new" {
+		if len(commandArgs) != 1 {
+			fmt.Fprintln(stderr, "new requires exactly one NAME argument")
+
+			return exitUsage
+		}
+
+		return report(stderr, newMigration(stdout, cnf, commandArgs[0]))
+	}
+
+	var cmd func(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error)
+
+	switch command {
+	case "up":
+		cmd = up
+	case "status":
+		cmd = status
+	case "plan":
+		cmd = plan
+	case "validate":
+		cmd = validate
+	case "baseline":
+		if len(commandArgs) < 1 || len(commandArgs) > 2 {
+			fmt.Fprintln(stderr, "baseline requires VERSION and optional PATH arguments")
+
+			return exitUsage
+		}
+
+		version, err := strconv.Atoi(commandArgs[0])
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid baseline version %q\n", commandArgs[0])
+
+			return exitUsage
+		}
+
+		dir := "/"
+		if len(commandArgs) == 2 {
+			dir = commandArgs[1]
+		}
+
+		cmd = func(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error) {
+			return baseline(ctx, db, cnf, stdout, dir, version)
+		}
+		commandArgs = nil
+	case "repair":
+		operation, err := parseRepair(commandArgs)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+
+			return exitUsage
+		}
+
+		cmd = func(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error) {
+			return repair(ctx, db, cnf, stdout, operation)
+		}
+		commandArgs = nil
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n", command)
+		fs.Usage()
+
+		return exitUsage
+	}
+
+	if len(commandArgs) != 0 {
+		fmt.Fprintf(stderr, "%s does not take arguments\n", command)
+
+		return exitUsage
+	}
+
+	if opts.dsn == "" {
+		fmt.Fprintln(stderr, "dsn is required")
+
+		return exitUsage
+	}
+
+	db, err := sql.Open(dialects[opts.dialect].driver, opts.dsn)
+	if err != nil {
+		return report(stderr, err)
+	}
+	defer db.Close()
+
+	code, err := cmd(ctx, db, cnf, stdout)
+	if err != nil {
+		return report(stderr, err)
+	}
+
+	return code
+}
+
+func (o options) config() (*igmigrator.Config, error) {
+	cnf := &igmigrator.Config{
+		MigrationsDir:   o.dir,
+		Schema:          o.schema,
+		MigrationTable:  o.table,
+		AppVersion:      o.appVersion,
+		SplitStatements: o.split,
+	}
+
+	for _, folder := range strings.Split(o.preFolders, ",") {
+		if folder = strings.TrimSpace(folder); folder != "" {
+			cnf.PreFolders = append(cnf.PreFolders, folder)
+		}
+	}
+
+	for _, pair := range strings.Split(o.values, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid value %q, expected KEY=VALUE", pair)
+		}
+
+		if cnf.Values == nil {
+			cnf.Values = make(map[string]string)
+		}
+
+		cnf.Values[strings.TrimSpace(key)] = value
+	}
+
+	database, ok := dialects[o.dialect]
+	if !ok {
+		return nil, fmt.Errorf("invalid dialect %q, expected postgres, mysql, sqlite or sqlserver", o.dialect)
+	}
+
+	cnf.Dialect = database.dialect
+
+	switch o.lock {
+	case "":
+	case "table":
+		cnf.Locker = igmigrator.TableLocker{Dialect: cnf.Dialect}
+	case "advisory":
+		if o.dialect != "postgres" {
+			return nil, fmt.Errorf("advisory lock requires postgres dialect, not %s", o.dialect)
+		}
+
+		cnf.Locker = igmigrator.AdvisoryLocker{}
+	default:
+		return nil, fmt.Errorf("invalid lock %q, expected table or advisory", o.lock)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{name: "lock timeout", value: o.lockTimeout, dst: &cnf.LockTimeout},
+		{name: "statement timeout", value: o.stmtTimeout, dst: &cnf.StatementTimeout},
+		{name: "max duration", value: o.maxDuration, dst: &cnf.MaxDuration},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", d.name, d.value, err)
+		}
+
+		*d.dst = duration
+	}
+
+	cnf.Sanitize()
+
+	return cnf, nil
+}
+
+// envDefault returns the environment variable as a flag default, def if it is not set.
+func envDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// envBool returns the environment variable as a flag default, false if it is not a boolean.
+func envBool(key string) bool {
+	v, _ := strconv.ParseBool(os.Getenv(key))
+
+	return v
+}
+
+func up(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error) {
+	result, err := igmigrator.Migrate(ctx, db, cnf)
+	if err != nil {
+		return exitError, err
+	}
+
+	paths := make([]string, 0, len(result.Path))
+	for p := range result.Path {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		fmt.Fprintf(stdout, "%s: %d -> %d\n", p, result.Path[p].PrevVersion, result.Path[p].NewVersion)
+
+		for _, file := range result.Files {
+			if file.Path != p {
+				continue
+			}
+
+			version := strconv.Itoa(file.Version)
+			if file.Version == 0 {
+				version = "repeatable"
+			}
+
+			fmt.Fprintf(stdout, "  %s\t%s\t%s\t%d rows\n", version, file.File, file.Duration, file.RowsAffected)
+		}
+	}
+
+	return exitOK, nil
+}
+
+func baseline(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer, dir string, version int) (int, error) {
+	result, err := igmigrator.Baseline(ctx, db, cnf, dir, version)
+	if err != nil {
+		return exitError, err
+	}
+
+	for p, v := range result.Path {
+		fmt.Fprintf(stdout, "%s: baseline at version %d\n", p, v.NewVersion)
+	}
+
+	return exitOK, nil
+}
+
+func repair(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer, operation igmigrator.RepairOperation) (int, error) {
+	result, err := igmigrator.Repair(ctx, db, cnf, operation)
+	if err != nil {
+		return exitError, err
+	}
+
+	if len(result.Changes) == 0 {
+		fmt.Fprintln(stdout, "nothing to repair")
+
+		return exitOK, nil
+	}
+
+	fmt.Fprint(stdout, result)
+
+	return exitOK, nil
+}
+
+// parseRepair parses arguments of the repair command, like `mark-applied / 5`.
+func parseRepair(args []string) (igmigrator.RepairOperation, error) {
+	if len(args) == 0 {
+		return igmigrator.RepairOperation{}, errors.New("repair requires an operation")
+	}
+
+	operation := igmigrator.RepairOperation{Kind: igmigrator.RepairKind(strings.ReplaceAll(args[0], "-", "_"))}
+	args = args[1:]
+
+	switch operation.Kind {
+	case igmigrator.RepairMarkApplied, igmigrator.RepairUnmark:
+		if len(args) != 2 {
+			return operation, fmt.Errorf("repair %s requires PATH and VERSION arguments", operation.Kind)
+		}
+
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return operation, fmt.Errorf("invalid repair version %q", args[1])
+		}
+
+		operation.Path, operation.Version = args[0], version
+	case igmigrator.RepairChecksums:
+		if len(args) > 1 {
+			return operation, fmt.Errorf("repair %s takes an optional PATH argument", operation.Kind)
+		}
+
+		if len(args) == 1 {
+			operation.Path = args[0]
+		}
+	case igmigrator.RepairOrphanedPaths:
+		if len(args) != 0 {
+			return operation, fmt.Errorf("repair %s does not take arguments", operation.Kind)
+		}
+	default:
+		return operation, fmt.Errorf("unknown repair operation %q", operation.Kind)
+	}
+
+	return operation, nil
+}
+
+func status(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error) {
+	result, err := igmigrator.Status(ctx, db, cnf)
+	if err != nil {
+		return exitError, err
+	}
+
+	fmt.Fprint(stdout, result)
+
+	return exitOK, nil
+}
+
+func plan(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error) {
+	result, err := igmigrator.Plan(ctx, db, cnf)
+	if err != nil {
+		return exitError, err
+	}
+
+	fmt.Fprint(stdout, result)
+
+	return exitOK, nil
+}
+
+func validate(ctx context.Context, db *sql.DB, cnf *igmigrator.Config, stdout io.Writer) (int, error) {
+	result, err := igmigrator.Validate(ctx, db, cnf)
+	if err != nil {
+		return exitError, err
+	}
+
+	if !result.HasIssues() {
+		fmt.Fprintln(stdout, "no issues found")
+
+		return exitOK, nil
+	}
+
+	fmt.Fprint(stdout, result)
+
+	return exitIssues, nil
+}
+
+// report writes err to w and returns the exit code for it.
+func report(w io.Writer, err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	fmt.Fprintln(w, "error:", err)
+
+	var migrationErr *igmigrator.MigrationError
+	if errors.As(err, &migrationErr) && migrationErr.Source != "" {
+		fmt.Fprint(w, migrationErr.Source)
+	}
+
+	return exitError
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_New(t *testing.T) {
+	dir := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), []string{"-dir", dir, "new", "Add users table"}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Equal(t, filepath.Join(dir, "1_add_users_table.sql")+"\n", stdout.String())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "7_other.sql"), nil, 0o644))
+
+	stdout.Reset()
+
+	code = run(context.Background(), []string{"-dir", dir, "new", "next"}, &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Equal(t, filepath.Join(dir, "8_next.sql")+"\n", stdout.String())
+}
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no command", args: nil},
+		{name: "unknown command", args: []string{"down"}},
+		{name: "missing dsn", args: []string{"-dsn", "", "up"}},
+		{name: "new without name", args: []string{"new"}},
+		{name: "invalid values", args: []string{"-values", "KEY", "plan"}},
+		{name: "invalid dialect", args: []string{"-dialect", "oracle", "plan"}},
+		{name: "invalid lock", args: []string{"-lock", "row", "plan"}},
+		{name: "advisory lock without postgres", args: []string{"-dialect", "mysql", "-lock", "advisory", "plan"}},
+		{name: "invalid lock timeout", args: []string{"-lock-timeout", "5", "plan"}},
+		{name: "invalid max duration", args: []string{"-max-duration", "long", "plan"}},
+		{name: "baseline without version", args: []string{"baseline"}},
+		{name: "invalid baseline version", args: []string{"baseline", "v2"}},
+		{name: "repair without operation", args: []string{"repair"}},
+		{name: "unknown repair operation", args: []string{"repair", "reset"}},
+		{name: "invalid repair version", args: []string{"repair", "unmark", "/", "v2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+
+			assert.Equal(t, exitUsage, run(context.Background(), tt.args, &stdout, &stderr))
+		})
+	}
+}
+
+func TestRun_SQLite(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1_create_accounts.sql"), []byte("CREATE TABLE accounts (id INTEGER PRIMARY KEY);\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "2_add_accounts_name.sql"), []byte("ALTER TABLE accounts ADD COLUMN name TEXT;\n"), 0o644))
+
+	args := []string{"-dialect", "sqlite", "-dsn", filepath.Join(t.TempDir(), "test.db"), "-dir", dir}
+
+	var stdout, stderr bytes.Buffer
+
+	code := run(context.Background(), append(args, "up"), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "/: 0 -> 2\n")
+
+	stdout.Reset()
+
+	code = run(context.Background(), append(args, "status"), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Contains(t, stdout.String(), "/: version 2, 2 applied, 0 pending\n")
+
+	stdout.Reset()
+
+	code = run(context.Background(), append(args, "validate"), &stdout, &stderr)
+	require.Equal(t, exitOK, code, stderr.String())
+	assert.Equal(t, "no issues found\n", stdout.String())
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/worldline-go/igmigrator/v2"
+)
+
+var nameRegexp = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// newMigration creates an empty migration file in the migrations directory with the next version.
+func newMigration(stdout io.Writer, cnf *igmigrator.Config, name string) error {
+	name = strings.Trim(nameRegexp.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return fmt.Errorf("invalid migration name")
+	}
+
+	m := igmigrator.Migrator{Cnf: cnf}
+
+	files, err := m.GetMigrationFiles(cnf.MigrationsDir, -1)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	version := 1
+	if len(files) > 0 {
+		version = igmigrator.VersionFromFile(files[len(files)-1]) + 1
+	}
+
+	if err := os.MkdirAll(cnf.MigrationsDir, 0o755); err != nil {
+		return err
+	}
+
+	fileName := filepath.Join(cnf.MigrationsDir, fmt.Sprintf("%d_%s.sql", version, name))
+
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(file, "-- %s\n", name); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, fileName)
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/worldline-go/logz"
 )
@@ -13,7 +14,7 @@ import (
 //
 // Most configuration options have sane defaults, which should not be changed if not specifically required.
 //
-// By default, no callbacks are not set.
+// By default, no hooks are set.
 type Config struct {
 	// MigrationsDir can provide a directory that will hold the migration files.
 	//
@@ -26,7 +27,7 @@ type Config struct {
 	Migrations    fs.FS
 	// PreFolders to run before migrations in the migration directory.
 	PreFolders []string
-	// Schema can specify which schema(using `set search_path`) should be used to run migrations in.
+	// Schema can specify which schema(using `set search_path` in PostgreSQL) should be used to run migrations in.
 	//
 	// By default, it will not change schema.
 	Schema string
@@ -37,9 +38,80 @@ type Config struct {
 	// if value for this variable is not set.
 	MigrationTable string
 
-	// Values for expand function in migration files.
+	// Values of `${name}` and `${name:-default}` variables in migration files.
+	// Variables in string literals, comments and dollar-quoted bodies are not replaced.
+	// Templates, files with `.sql.tmpl` suffix, get them as `.Values`.
 	Values map[string]string
 
+	// AppVersion is the version of the application, recorded with every applied migration.
+	AppVersion string
+
+	// SplitStatements runs statements of migration files one by one with the splitter of the dialect,
+	// logging duration and affected rows of each statement.
+	//
+	// It is needed for drivers without multiple statements in one call, like MySQL without `multiStatements`
+	// or SQL Server batches separated by `GO`. In PostgreSQL StatementTimeout then limits each statement.
+	SplitStatements bool
+
+	// AllowOutOfOrder applies not yet applied migration files with a version below the current version.
+	//
+	// By default, migration fails when such files are found.
+	AllowOutOfOrder bool
+
+	// BaselineVersion records migrations up to this version as applied without running them
+	// when the migration table is empty, to bring an existing database under migration.
+	//
+	// By default, all migrations run on an empty migration table.
+	BaselineVersion int
+
+	// WarnChecksumMismatch only logs a warning when an applied migration file has been changed.
+	//
+	// By default, migration fails if checksum of an applied file differs from the recorded one.
+	WarnChecksumMismatch bool
+
+	// Dialect holds database specific statements.
+	//
+	// By default, PostgreSQLDialect is used.
+	Dialect Dialect
+
+	// Locker locks the migration table before versions are read.
+	//
+	// By default, the locker of the Dialect is used, MySQLLocker for MySQLDialect and TableLocker for others.
+	// AdvisoryLocker uses PostgreSQL advisory locks.
+	Locker Locker
+
+	// LockTimeout limits waiting for the lock, LockTimeoutError is returned with holders of the lock when it is exceeded.
+	//
+	// By default, lock is waited until the context is done.
+	LockTimeout time.Duration
+
+	// StatementTimeout limits duration of each migration file, it can be overridden in the file
+	// with `-- igmigrator:statement-timeout 10m` directive.
+	//
+	// In PostgreSQL it is set with `SET LOCAL statement_timeout` and the server cancels the file,
+	// with SplitStatements the timeout applies to each statement instead of the whole file.
+	// In MySQL, SQLite, SQL Server and for non-transactional files the context deadline of the file is used;
+	// the driver cancels the running statement, the MySQL driver closes the connection and the server can finish it.
+	//
+	// By default, migration files run without limit.
+	StatementTimeout time.Duration
+
+	// MaxDuration limits the whole migration run, the running migration is stopped and ErrMaxDuration is returned
+	// when it is exceeded, with the file name if a migration file is running.
+	// Deadline of the caller's context is returned as the context error, not as ErrMaxDuration.
+	//
+	// By default, migrations run until the context is done.
+	MaxDuration time.Duration
+
+	// BeforeAll is called once in the first transaction of Migrate, after the lock is acquired.
+	BeforeAll HookFunc
+	// BeforeMigration is called before each migration.
+	BeforeMigration MigrationHookFunc
+	// AfterMigration is called after each successful migration with its duration.
+	AfterMigration MigrationHookFunc
+	// AfterAll is called once in the last transaction of Migrate with versions of all directories.
+	AfterAll ResultHookFunc
+
 	Logger logz.Adapter
 }
 
@@ -75,3 +147,22 @@ func (c *Config) Sanitize() {
 		c.MigrationsDir = "."
 	}
 }
+
+// dialect returns Config.Dialect, PostgreSQLDialect if it is not set.
+func (c *Config) dialect() Dialect {
+	if c.Dialect == nil {
+		return PostgreSQLDialect{}
+	}
+
+	return c.Dialect
+}
+
+// locker returns Config.Locker, the locker of the dialect if it is not set.
+// It is not stored in the config, so a dialect set later gets its own locker.
+func (c *Config) locker() Locker {
+	if c.Locker != nil {
+		return c.Locker
+	}
+
+	return dialectDefaults{Dialect: c.dialect()}.Locker()
+}
@@ -56,3 +56,21 @@ func TestConfig_SetDefaults(t *testing.T) {
 
 	}
 }
+
+func TestConfig_Locker(t *testing.T) {
+	cnf := &Config{}
+	cnf.Sanitize()
+
+	assert.Nil(t, cnf.Dialect)
+	assert.Nil(t, cnf.Locker)
+	assert.Equal(t, TableLocker{Dialect: PostgreSQLDialect{}}, cnf.locker())
+
+	// Reused config gets the locker of the dialect set later.
+	cnf.Dialect = MySQLDialect{}
+	cnf.Sanitize()
+
+	assert.Equal(t, MySQLLocker{}, cnf.locker())
+
+	cnf.Locker = AdvisoryLocker{}
+	assert.Equal(t, AdvisoryLocker{}, cnf.locker())
+}
@@ -0,0 +1,775 @@
+package igmigrator
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect holds database specific statements used by the Migrator.
+//
+// Table and schema names are already sanitized when passed to the dialect,
+// so no extra quoting is required.
+//
+// Other features are optional interfaces, like TimeoutSetter or StatementSplitter,
+// dialects without them get standard SQL or the feature is skipped. Built-in dialects implement all of them.
+type Dialect interface {
+	// Placeholder returns the bind parameter for the n-th (starting from 1) argument of a statement.
+	Placeholder(n int) string
+	// SetSchema returns statement that switches current schema.
+	// Empty string means that switching schema is not supported and it is skipped.
+	SetSchema(schema string) string
+	// CreateMigrationTable returns statement that creates migration table if it does not exist.
+	CreateMigrationTable(table string) string
+	// LockTable returns statement that locks the migration table till the end of the transaction.
+	// Empty string means that locking is not required and it is skipped.
+	LockTable(table string) string
+}
+
+// TableCreator is implemented by dialects creating the tables next to the migration table.
+// Without it standard `CREATE TABLE IF NOT EXISTS` statements are used.
+type TableCreator interface {
+	// CreateMetadataTable returns statement that creates the table of migration table layout versions if it does not exist.
+	CreateMetadataTable(table string) string
+	// CreateRepeatableTable returns statement that creates the table of repeatable migration checksums if it does not exist.
+	CreateRepeatableTable(table string) string
+}
+
+// TimeoutSetter is implemented by dialects limiting waits in the database.
+// Without it locks are waited without limit and the context deadline limits statements.
+type TimeoutSetter interface {
+	// LockTimeout returns statement that limits waiting for locks, zero timeout restores the default.
+	// Empty string means that it is not supported and locks are waited without limit.
+	LockTimeout(timeout time.Duration) string
+	// StatementTimeout returns statement that limits duration of next statements in the transaction,
+	// zero timeout restores the default.
+	// Empty string means that it is not supported and the context deadline is used instead.
+	StatementTimeout(timeout time.Duration) string
+}
+
+// SchemaInspector is implemented by dialects looking up tables and columns.
+// Without it `information_schema` is queried.
+type SchemaInspector interface {
+	// TableExists returns query with a single boolean result, true if the table exists.
+	// Schema is empty if it is not set in the configuration.
+	TableExists(schema, table string) string
+	// ColumnExists returns query with a single boolean result, true if the column exists in the table.
+	ColumnExists(schema, table, column string) string
+}
+
+// TableUpgrader is implemented by dialects changing the migration table of previous igmigrator versions.
+// Without it columns are added with `ALTER TABLE ... ADD COLUMN` and the primary key is kept.
+type TableUpgrader interface {
+	// AddColumn returns statement that adds a new column to the table.
+	AddColumn(table, column, definition string) string
+	// ReplacePrimaryKey returns statement that drops the primary key of the table and adds a new one on the columns.
+	// Empty string means that it is not supported and the primary key is kept.
+	ReplacePrimaryKey(table, columns string) string
+}
+
+// UserReporter is implemented by dialects reporting the user recorded with applied migrations.
+// Without it the user is not recorded.
+type UserReporter interface {
+	// CurrentUser returns query with a single result, the user of the database session.
+	// Empty string means that database has no users and it is not recorded.
+	CurrentUser() string
+}
+
+// StatementSplitter is implemented by dialects splitting migration files for Config.SplitStatements.
+// Without it files are split with standard SQL syntax: strings in single quotes, identifiers in double quotes
+// and `--` or `/* */` comments. The same syntax is used to skip literals when variables are replaced.
+type StatementSplitter interface {
+	// SplitStatements splits a migration file into statements.
+	SplitStatements(sql string) []Statement
+}
+
+// Quoter is implemented by dialects quoting names and values, used by `quoteIdent` and `quoteLiteral` of templates.
+// Without it names are quoted with double quotes and values with single quotes.
+type Quoter interface {
+	// QuoteIdent quotes a single name, like a table or a column.
+	QuoteIdent(name string) string
+	// QuoteLiteral quotes a string value.
+	QuoteLiteral(value string) string
+}
+
+// LockerProvider is implemented by dialects choosing the locker used when Config.Locker is not set,
+// like MySQL where DDL statements commit the transaction implicitly and release the lock of TableLocker.
+// Without it TableLocker is used.
+type LockerProvider interface {
+	// Locker returns the default locker of the dialect.
+	Locker() Locker
+}
+
+// LockTimeoutDetector is implemented by dialects recognizing errors of locks not acquired in the timeout of LockTimeout.
+// Without it only the `55P03` SQLSTATE of PostgreSQL is recognized.
+type LockTimeoutDetector interface {
+	// IsLockTimeout reports whether err is returned because waiting for a lock exceeded the lock timeout.
+	IsLockTimeout(err error) bool
+}
+
+// dialectDefaults adds standard SQL to a Dialect for optional interfaces it does not implement.
+type dialectDefaults struct {
+	Dialect
+}
+
+func (d dialectDefaults) CreateMetadataTable(table string) string {
+	if c, ok := d.Dialect.(TableCreator); ok {
+		return c.CreateMetadataTable(table)
+	}
+
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		version     INT NOT NULL PRIMARY KEY,
+		upgraded_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+}
+
+func (d dialectDefaults) CreateRepeatableTable(table string) string {
+	if c, ok := d.Dialect.(TableCreator); ok {
+		return c.CreateRepeatableTable(table)
+	}
+
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(1000) NOT NULL DEFAULT '/',
+		name        VARCHAR(255) NOT NULL,
+		migrated_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		checksum    VARCHAR(64) NOT NULL,
+		PRIMARY KEY (path, name)
+	)`
+}
+
+func (d dialectDefaults) LockTimeout(timeout time.Duration) string {
+	if t, ok := d.Dialect.(TimeoutSetter); ok {
+		return t.LockTimeout(timeout)
+	}
+
+	return ""
+}
+
+func (d dialectDefaults) StatementTimeout(timeout time.Duration) string {
+	if t, ok := d.Dialect.(TimeoutSetter); ok {
+		return t.StatementTimeout(timeout)
+	}
+
+	return ""
+}
+
+func (d dialectDefaults) TableExists(schema, table string) string {
+	if i, ok := d.Dialect.(SchemaInspector); ok {
+		return i.TableExists(schema, table)
+	}
+
+	return existsQuery("SELECT 1 FROM information_schema.tables WHERE " + schemaCondition(schema) + "table_name = '" + table + "'")
+}
+
+func (d dialectDefaults) ColumnExists(schema, table, column string) string {
+	if i, ok := d.Dialect.(SchemaInspector); ok {
+		return i.ColumnExists(schema, table, column)
+	}
+
+	return existsQuery("SELECT 1 FROM information_schema.columns WHERE " + schemaCondition(schema) +
+		"table_name = '" + table + "' AND column_name = '" + column + "'")
+}
+
+// existsQuery returns query with a single result, 1 if the subquery returns any row and 0 otherwise.
+// Count of rows is not used, the same table can exist in multiple schemas when schema is not set.
+func existsQuery(subquery string) string {
+	return "SELECT CASE WHEN EXISTS (" + subquery + ") THEN 1 ELSE 0 END"
+}
+
+// schemaCondition returns condition on table_schema of information_schema, empty if schema is not set.
+func schemaCondition(schema string) string {
+	if schema == "" {
+		return ""
+	}
+
+	return "table_schema = '" + schema + "' AND "
+}
+
+func (d dialectDefaults) AddColumn(table, column, definition string) string {
+	if u, ok := d.Dialect.(TableUpgrader); ok {
+		return u.AddColumn(table, column, definition)
+	}
+
+	return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition
+}
+
+func (d dialectDefaults) ReplacePrimaryKey(table, columns string) string {
+	if u, ok := d.Dialect.(TableUpgrader); ok {
+		return u.ReplacePrimaryKey(table, columns)
+	}
+
+	return ""
+}
+
+func (d dialectDefaults) CurrentUser() string {
+	if r, ok := d.Dialect.(UserReporter); ok {
+		return r.CurrentUser()
+	}
+
+	return ""
+}
+
+func (d dialectDefaults) SplitStatements(sql string) []Statement {
+	if s, ok := d.Dialect.(StatementSplitter); ok {
+		return s.SplitStatements(sql)
+	}
+
+	return splitStatements(sql, d.syntax())
+}
+
+// syntax returns rules of the built-in dialect to find literals and comments, standard SQL for other dialects.
+func (d dialectDefaults) syntax() splitRules {
+	if s, ok := d.Dialect.(interface{ syntax() splitRules }); ok {
+		return s.syntax()
+	}
+
+	return splitRules{}
+}
+
+func (d dialectDefaults) QuoteIdent(name string) string {
+	if q, ok := d.Dialect.(Quoter); ok {
+		return q.QuoteIdent(name)
+	}
+
+	return quoteWith(name, `"`)
+}
+
+func (d dialectDefaults) QuoteLiteral(value string) string {
+	if q, ok := d.Dialect.(Quoter); ok {
+		return q.QuoteLiteral(value)
+	}
+
+	return quoteWith(value, "'")
+}
+
+func (d dialectDefaults) Locker() Locker {
+	if p, ok := d.Dialect.(LockerProvider); ok {
+		return p.Locker()
+	}
+
+	return TableLocker{Dialect: d.Dialect}
+}
+
+func (d dialectDefaults) IsLockTimeout(err error) bool {
+	if l, ok := d.Dialect.(LockTimeoutDetector); ok {
+		return l.IsLockTimeout(err)
+	}
+
+	return PostgreSQLDialect{}.IsLockTimeout(err)
+}
+
+// quoteWith surrounds s with quote and doubles the quote inside.
+func quoteWith(s, quote string) string {
+	return quote + strings.ReplaceAll(s, quote, quote+quote) + quote
+}
+
+// qualifiedName returns name prefixed with schema if schema is not empty.
+func qualifiedName(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+
+	return schema + "." + name
+}
+
+// PostgreSQLDialect is the default dialect.
+type PostgreSQLDialect struct{}
+
+func (PostgreSQLDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (PostgreSQLDialect) SetSchema(schema string) string {
+	return "set local search_path = " + schema
+}
+
+func (PostgreSQLDialect) CreateMigrationTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(1000) NOT NULL DEFAULT '/',
+		version     INT,
+		migrated_on	TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		checksum    VARCHAR(64),
+		file        VARCHAR(255),
+		duration_ms BIGINT,
+		applied_by  VARCHAR(255),
+		hostname    VARCHAR(255),
+		app_version VARCHAR(255),
+		PRIMARY KEY (path, version)
+	)`
+}
+
+func (PostgreSQLDialect) CreateMetadataTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		version     INT NOT NULL PRIMARY KEY,
+		upgraded_on	TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+}
+
+func (PostgreSQLDialect) CreateRepeatableTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(1000) NOT NULL DEFAULT '/',
+		name        VARCHAR(255) NOT NULL,
+		migrated_on	TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		checksum    VARCHAR(64) NOT NULL,
+		PRIMARY KEY (path, name)
+	)`
+}
+
+func (PostgreSQLDialect) LockTable(table string) string {
+	return "lock table " + table + " in ACCESS EXCLUSIVE mode;"
+}
+
+func (PostgreSQLDialect) Locker() Locker {
+	return TableLocker{Dialect: PostgreSQLDialect{}}
+}
+
+func (PostgreSQLDialect) LockTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "SET LOCAL lock_timeout = DEFAULT"
+	}
+
+	return fmt.Sprintf("SET LOCAL lock_timeout = '%dms'", timeout.Milliseconds())
+}
+
+func (PostgreSQLDialect) IsLockTimeout(err error) bool {
+	var stateErr interface{ SQLState() string }
+
+	return errors.As(err, &stateErr) && stateErr.SQLState() == "55P03" // lock_not_available
+}
+
+func (PostgreSQLDialect) StatementTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "SET LOCAL statement_timeout = DEFAULT"
+	}
+
+	return fmt.Sprintf("SET LOCAL statement_timeout = '%dms'", timeout.Milliseconds())
+}
+
+func (PostgreSQLDialect) TableExists(schema, table string) string {
+	return "SELECT to_regclass('" + qualifiedName(schema, table) + "') IS NOT NULL"
+}
+
+func (PostgreSQLDialect) ColumnExists(schema, table, column string) string {
+	schemaName := "current_schema()"
+	if schema != "" {
+		schemaName = "'" + schema + "'"
+	}
+
+	return "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = " + schemaName +
+		" AND table_name = '" + table + "' AND column_name = '" + column + "')"
+}
+
+func (PostgreSQLDialect) CurrentUser() string {
+	return "SELECT current_user"
+}
+
+func (PostgreSQLDialect) AddColumn(table, column, definition string) string {
+	return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition
+}
+
+func (PostgreSQLDialect) ReplacePrimaryKey(table, columns string) string {
+	// Name of the primary key is usually <table>_pkey but it is looked up to not depend on it.
+	return `DO $$
+	DECLARE pk TEXT;
+	BEGIN
+		SELECT conname INTO pk FROM pg_constraint WHERE conrelid = '` + table + `'::regclass AND contype = 'p';
+		IF pk IS NOT NULL THEN
+			EXECUTE 'ALTER TABLE ` + table + ` DROP CONSTRAINT ' || quote_ident(pk);
+		END IF;
+		ALTER TABLE ` + table + ` ADD PRIMARY KEY (` + columns + `);
+	END $$`
+}
+
+func (d PostgreSQLDialect) SplitStatements(sql string) []Statement {
+	return splitStatements(sql, d.syntax())
+}
+
+func (PostgreSQLDialect) syntax() splitRules {
+	return splitRules{dollarQuotes: true, nestedComments: true}
+}
+
+func (PostgreSQLDialect) QuoteIdent(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (PostgreSQLDialect) QuoteLiteral(value string) string {
+	return quoteWith(value, "'")
+}
+
+// MySQLDialect is dialect for MySQL and MariaDB.
+//
+// Schema is switched with `USE` and it stays for the whole session of the connection.
+type MySQLDialect struct{}
+
+func (MySQLDialect) Placeholder(int) string {
+	return "?"
+}
+
+func (MySQLDialect) SetSchema(schema string) string {
+	return "USE " + schema
+}
+
+func (MySQLDialect) CreateMigrationTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(255) NOT NULL DEFAULT '/',
+		version     INT NOT NULL,
+		migrated_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		checksum    VARCHAR(64),
+		file        VARCHAR(255),
+		duration_ms BIGINT,
+		applied_by  VARCHAR(255),
+		hostname    VARCHAR(255),
+		app_version VARCHAR(255),
+		PRIMARY KEY (path, version)
+	)`
+}
+
+func (MySQLDialect) CreateMetadataTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		version     INT NOT NULL PRIMARY KEY,
+		upgraded_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+}
+
+func (MySQLDialect) CreateRepeatableTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(255) NOT NULL DEFAULT '/',
+		name        VARCHAR(255) NOT NULL,
+		migrated_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		checksum    VARCHAR(64) NOT NULL,
+		PRIMARY KEY (path, name)
+	)`
+}
+
+func (MySQLDialect) LockTable(table string) string {
+	// LOCK TABLES commits the transaction implicitly, locking read rows is used instead.
+	return "SELECT version FROM " + table + " FOR UPDATE"
+}
+
+func (MySQLDialect) Locker() Locker {
+	// DDL statements commit the transaction implicitly, the named lock is kept on the connection.
+	return MySQLLocker{}
+}
+
+func (MySQLDialect) LockTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "SET SESSION innodb_lock_wait_timeout = DEFAULT"
+	}
+
+	// Timeout is in seconds, rounded up to not wait less than configured.
+	return fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", int64((timeout+time.Second-1)/time.Second))
+}
+
+func (MySQLDialect) IsLockTimeout(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if mysqlErrorNumber(err) == 1205 { // ER_LOCK_WAIT_TIMEOUT
+			return true
+		}
+	}
+
+	return false
+}
+
+// mysqlErrorTypes are driver errors with a Number field of the MySQL error, by package path and type name.
+// The driver is not imported and its error has no methods, the field is read with reflection only for these types.
+var mysqlErrorTypes = map[string]struct{}{
+	// *mysql.MySQLError of go-sql-driver/mysql.
+	"github.com/go-sql-driver/mysql.MySQLError": {},
+}
+
+// mysqlErrorNumber returns the Number field of the error, 0 if it is not one of mysqlErrorTypes.
+func mysqlErrorNumber(err error) uint64 {
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+
+	if _, ok := mysqlErrorTypes[v.Type().PkgPath()+"."+v.Type().Name()]; !ok {
+		return 0
+	}
+
+	field := v.FieldByName("Number")
+	if field.Kind() != reflect.Uint16 {
+		return 0
+	}
+
+	return field.Uint()
+}
+
+func (MySQLDialect) StatementTimeout(time.Duration) string {
+	// max_execution_time only limits SELECT statements.
+	return ""
+}
+
+func (MySQLDialect) TableExists(schema, table string) string {
+	dbName := "DATABASE()"
+	if schema != "" {
+		dbName = "'" + schema + "'"
+	}
+
+	return "SELECT COUNT(*) > 0 FROM information_schema.tables WHERE table_schema = " + dbName + " AND table_name = '" + table + "'"
+}
+
+func (MySQLDialect) ColumnExists(schema, table, column string) string {
+	dbName := "DATABASE()"
+	if schema != "" {
+		dbName = "'" + schema + "'"
+	}
+
+	return "SELECT COUNT(*) > 0 FROM information_schema.columns WHERE table_schema = " + dbName +
+		" AND table_name = '" + table + "' AND column_name = '" + column + "'"
+}
+
+func (MySQLDialect) CurrentUser() string {
+	return "SELECT CURRENT_USER()"
+}
+
+func (MySQLDialect) AddColumn(table, column, definition string) string {
+	return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition
+}
+
+func (MySQLDialect) ReplacePrimaryKey(table, columns string) string {
+	return "ALTER TABLE " + table + " DROP PRIMARY KEY, ADD PRIMARY KEY (" + columns + ")"
+}
+
+func (d MySQLDialect) SplitStatements(sql string) []Statement {
+	return splitStatements(sql, d.syntax())
+}
+
+func (MySQLDialect) syntax() splitRules {
+	return splitRules{backslashEscapes: true, hashComments: true, backticks: true}
+}
+
+func (MySQLDialect) QuoteIdent(name string) string {
+	// Double quotes are strings without ANSI_QUOTES.
+	return quoteWith(name, "`")
+}
+
+func (MySQLDialect) QuoteLiteral(value string) string {
+	return quoteWith(strings.ReplaceAll(value, `\`, `\\`), "'")
+}
+
+// SQLiteDialect is dialect for SQLite.
+//
+// SQLite has no schema switching and serializes writers itself, so no lock is taken.
+// Schema can still be used to point to an attached database.
+type SQLiteDialect struct{}
+
+func (SQLiteDialect) Placeholder(int) string {
+	return "?"
+}
+
+func (SQLiteDialect) SetSchema(string) string {
+	return ""
+}
+
+func (SQLiteDialect) CreateMigrationTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(1000) NOT NULL DEFAULT '/',
+		version     INT NOT NULL,
+		migrated_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		checksum    VARCHAR(64),
+		file        VARCHAR(255),
+		duration_ms BIGINT,
+		applied_by  VARCHAR(255),
+		hostname    VARCHAR(255),
+		app_version VARCHAR(255),
+		PRIMARY KEY (path, version)
+	)`
+}
+
+func (SQLiteDialect) CreateMetadataTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		version     INT NOT NULL PRIMARY KEY,
+		upgraded_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+}
+
+func (SQLiteDialect) CreateRepeatableTable(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		path        VARCHAR(1000) NOT NULL DEFAULT '/',
+		name        VARCHAR(255) NOT NULL,
+		migrated_on	TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		checksum    VARCHAR(64) NOT NULL,
+		PRIMARY KEY (path, name)
+	)`
+}
+
+func (SQLiteDialect) LockTable(string) string {
+	return ""
+}
+
+func (SQLiteDialect) Locker() Locker {
+	return TableLocker{Dialect: SQLiteDialect{}}
+}
+
+func (SQLiteDialect) LockTimeout(time.Duration) string {
+	return ""
+}
+
+func (SQLiteDialect) IsLockTimeout(error) bool {
+	return false
+}
+
+func (SQLiteDialect) StatementTimeout(time.Duration) string {
+	return ""
+}
+
+func (SQLiteDialect) TableExists(schema, table string) string {
+	return "SELECT COUNT(*) > 0 FROM " + qualifiedName(schema, "sqlite_master") + " WHERE type = 'table' AND name = '" + table + "'"
+}
+
+func (SQLiteDialect) ColumnExists(schema, table, column string) string {
+	args := "'" + table + "'"
+	if schema != "" {
+		args += ", '" + schema + "'"
+	}
+
+	return "SELECT COUNT(*) > 0 FROM pragma_table_info(" + args + ") WHERE name = '" + column + "'"
+}
+
+func (SQLiteDialect) CurrentUser() string {
+	return ""
+}
+
+func (SQLiteDialect) AddColumn(table, column, definition string) string {
+	return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition
+}
+
+func (SQLiteDialect) ReplacePrimaryKey(string, string) string {
+	// Primary key cannot be altered without recreating the table.
+	return ""
+}
+
+func (d SQLiteDialect) SplitStatements(sql string) []Statement {
+	return splitStatements(sql, d.syntax())
+}
+
+func (SQLiteDialect) syntax() splitRules {
+	return splitRules{backticks: true, brackets: true}
+}
+
+func (SQLiteDialect) QuoteIdent(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (SQLiteDialect) QuoteLiteral(value string) string {
+	return quoteWith(value, "'")
+}
+
+// SQLServerDialect is dialect for Microsoft SQL Server.
+//
+// Default schema of the user cannot be switched in a session, so migration files should use qualified names.
+type SQLServerDialect struct{}
+
+func (SQLServerDialect) Placeholder(n int) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+func (SQLServerDialect) SetSchema(string) string {
+	return ""
+}
+
+func (SQLServerDialect) CreateMigrationTable(table string) string {
+	return `IF OBJECT_ID(N'` + table + `', N'U') IS NULL CREATE TABLE ` + table + ` (
+		path        NVARCHAR(400) NOT NULL DEFAULT '/',
+		version     INT NOT NULL,
+		migrated_on	DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET(),
+		checksum    VARCHAR(64),
+		file        VARCHAR(255),
+		duration_ms BIGINT,
+		applied_by  VARCHAR(255),
+		hostname    VARCHAR(255),
+		app_version VARCHAR(255),
+		PRIMARY KEY (path, version)
+	)`
+}
+
+func (SQLServerDialect) CreateMetadataTable(table string) string {
+	return `IF OBJECT_ID(N'` + table + `', N'U') IS NULL CREATE TABLE ` + table + ` (
+		version     INT NOT NULL PRIMARY KEY,
+		upgraded_on	DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET()
+	)`
+}
+
+func (SQLServerDialect) CreateRepeatableTable(table string) string {
+	// Primary key is limited to 900 bytes.
+	return `IF OBJECT_ID(N'` + table + `', N'U') IS NULL CREATE TABLE ` + table + ` (
+		path        NVARCHAR(300) NOT NULL DEFAULT '/',
+		name        NVARCHAR(150) NOT NULL,
+		migrated_on	DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET(),
+		checksum    VARCHAR(64) NOT NULL,
+		PRIMARY KEY (path, name)
+	)`
+}
+
+func (SQLServerDialect) LockTable(table string) string {
+	return "SELECT COUNT(*) FROM " + table + " WITH (TABLOCKX, HOLDLOCK)"
+}
+
+func (SQLServerDialect) Locker() Locker {
+	return TableLocker{Dialect: SQLServerDialect{}}
+}
+
+func (SQLServerDialect) LockTimeout(timeout time.Duration) string {
+	if timeout <= 0 {
+		return "SET LOCK_TIMEOUT -1"
+	}
+
+	return fmt.Sprintf("SET LOCK_TIMEOUT %d", timeout.Milliseconds())
+}
+
+func (SQLServerDialect) IsLockTimeout(err error) bool {
+	var numberErr interface{ SQLErrorNumber() int32 }
+
+	return errors.As(err, &numberErr) && numberErr.SQLErrorNumber() == 1222 // lock request time out period exceeded
+}
+
+func (SQLServerDialect) StatementTimeout(time.Duration) string {
+	return ""
+}
+
+func (SQLServerDialect) TableExists(schema, table string) string {
+	return "SELECT CASE WHEN OBJECT_ID(N'" + qualifiedName(schema, table) + "', N'U') IS NULL THEN 0 ELSE 1 END"
+}
+
+func (SQLServerDialect) ColumnExists(schema, table, column string) string {
+	return "SELECT CASE WHEN COL_LENGTH(N'" + qualifiedName(schema, table) + "', N'" + column + "') IS NULL THEN 0 ELSE 1 END"
+}
+
+func (SQLServerDialect) CurrentUser() string {
+	return "SELECT SUSER_SNAME()"
+}
+
+func (SQLServerDialect) AddColumn(table, column, definition string) string {
+	return "ALTER TABLE " + table + " ADD " + column + " " + definition
+}
+
+func (SQLServerDialect) ReplacePrimaryKey(table, columns string) string {
+	return `DECLARE @pk SYSNAME = (SELECT name FROM sys.key_constraints WHERE parent_object_id = OBJECT_ID(N'` + table + `') AND type = 'PK');
+	IF @pk IS NOT NULL EXEC(N'ALTER TABLE ` + table + ` DROP CONSTRAINT ' + QUOTENAME(@pk));
+	ALTER TABLE ` + table + ` ADD PRIMARY KEY (` + columns + `)`
+}
+
+func (d SQLServerDialect) SplitStatements(sql string) []Statement {
+	return splitStatements(sql, d.syntax())
+}
+
+func (SQLServerDialect) syntax() splitRules {
+	return splitRules{brackets: true, batchSeparator: "GO"}
+}
+
+func (SQLServerDialect) QuoteIdent(name string) string {
+	return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+}
+
+func (SQLServerDialect) QuoteLiteral(value string) string {
+	return quoteWith(value, "'")
+}
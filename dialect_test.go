@@ -0,0 +1,146 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+// customDialect implements only Dialect, optional features have defaults.
+type customDialect struct{}
+
+func (customDialect) Placeholder(n int) string { return "?" }
+
+func (customDialect) SetSchema(schema string) string { return "" }
+
+func (customDialect) CreateMigrationTable(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (path VARCHAR(1000), version INT)"
+}
+
+func (customDialect) LockTable(table string) string { return "" }
+
+func TestMigrate_Dialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		locker  Locker
+		schema  string
+		init    func(mck sqlmock.Sqlmock)
+	}{
+		{
+			name:    "mysql",
+			dialect: MySQLDialect{},
+			locker:  TableLocker{Dialect: MySQLDialect{}},
+			schema:  "test",
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectExec("USE test").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS test.migration \\( path VARCHAR\\(255\\) NOT NULL DEFAULT '/', version INT NOT NULL, migrated_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, checksum VARCHAR\\(64\\), file VARCHAR\\(255\\), duration_ms BIGINT, applied_by VARCHAR\\(255\\), hostname VARCHAR\\(255\\), app_version VARCHAR\\(255\\), PRIMARY KEY \\(path, version\\) \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS test.migration_metadata \\( version INT NOT NULL PRIMARY KEY, upgraded_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("SELECT version FROM test.migration FOR UPDATE").WillReturnResult(sqlmock.NewResult(0, 0))
+				// Table created before the metadata table is upgraded once.
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM test.migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'path'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'checksum'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+				mck.ExpectExec("ALTER TABLE test.migration ADD COLUMN checksum VARCHAR\\(64\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'file'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+				mck.ExpectExec("ALTER TABLE test.migration ADD COLUMN file VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'duration_ms'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+				mck.ExpectExec("ALTER TABLE test.migration ADD COLUMN duration_ms BIGINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'applied_by'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+				mck.ExpectExec("ALTER TABLE test.migration ADD COLUMN applied_by VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'hostname'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+				mck.ExpectExec("ALTER TABLE test.migration ADD COLUMN hostname VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT COUNT\\(\\*\\) > 0 FROM information_schema.columns WHERE table_schema = 'test' AND table_name = 'migration' AND column_name = 'app_version'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+				mck.ExpectExec("ALTER TABLE test.migration ADD COLUMN app_version VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("INSERT INTO test.migration_metadata\\(version\\) VALUES \\(\\?\\)").WithArgs(MetadataVersion()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mck.ExpectQuery("SELECT version FROM test.migration WHERE path = \\? ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mck.ExpectQuery("SELECT version, checksum FROM test.migration WHERE path = \\? AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM test.migration WHERE path = \\?").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT CURRENT_USER\\(\\)").WillReturnRows(sqlmock.NewRows([]string{"user"}).AddRow("migrator@localhost"))
+				mck.ExpectExec("INSERT INTO test.migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name:    "sqlite",
+			dialect: SQLiteDialect{},
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration \\( path VARCHAR\\(1000\\) NOT NULL DEFAULT '/', version INT NOT NULL, migrated_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, checksum VARCHAR\\(64\\), file VARCHAR\\(255\\), duration_ms BIGINT, applied_by VARCHAR\\(255\\), hostname VARCHAR\\(255\\), app_version VARCHAR\\(255\\), PRIMARY KEY \\(path, version\\) \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\? ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\? AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration WHERE path = \\?").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name:    "custom",
+			dialect: customDialect{},
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration \\(path VARCHAR\\(1000\\), version INT\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata \\( version INT NOT NULL PRIMARY KEY, upgraded_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+				mck.ExpectQuery("SELECT CASE WHEN EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_name = 'migration' AND column_name = 'path'\\) THEN 1 ELSE 0 END").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(1))
+				for _, column := range []string{"checksum", "file", "duration_ms", "applied_by", "hostname", "app_version"} {
+					mck.ExpectQuery("SELECT CASE WHEN EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_name = 'migration' AND column_name = '" + column + "'\\) THEN 1 ELSE 0 END").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(0))
+					mck.ExpectExec("ALTER TABLE migration ADD COLUMN " + column).WillReturnResult(sqlmock.NewResult(0, 0))
+				}
+				mck.ExpectExec("INSERT INTO migration_metadata\\(version\\) VALUES \\(\\?\\)").WithArgs(MetadataVersion()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\? ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\? AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration WHERE path = \\?").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\) VALUES \\(\\?, \\?, \\?, \\?, \\?, \\?, \\?, \\?\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name:    "sqlserver",
+			dialect: SQLServerDialect{},
+			schema:  "dbo",
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectExec("IF OBJECT_ID\\(N'dbo.migration', N'U'\\) IS NULL CREATE TABLE dbo.migration").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("IF OBJECT_ID\\(N'dbo.migration_metadata', N'U'\\) IS NULL CREATE TABLE dbo.migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("SELECT COUNT\\(\\*\\) FROM dbo.migration WITH \\(TABLOCKX, HOLDLOCK\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM dbo.migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+				mck.ExpectQuery("SELECT version FROM dbo.migration WHERE path = @p1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mck.ExpectQuery("SELECT version, checksum FROM dbo.migration WHERE path = @p1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM dbo.migration WHERE path = @p1").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT SUSER_SNAME\\(\\)").WillReturnRows(sqlmock.NewRows([]string{"user"}).AddRow("migrator"))
+				mck.ExpectExec("INSERT INTO dbo.migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\) VALUES \\(@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+	}
+
+	for _, scenario := range tests {
+		t.Run(scenario.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			scenario.init(mck)
+			mck.ExpectCommit()
+
+			conf := &Config{
+				MigrationsDir: testdata.Path("locking"),
+				Schema:        scenario.schema,
+				Dialect:       scenario.dialect,
+				Locker:        scenario.locker,
+			}
+
+			result, err := Migrate(context.Background(), db, conf)
+			require.NoError(t, err)
+			require.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 1}, result.Path["/"])
+			require.NoError(t, mck.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package igmigrator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DirectivePrefix starts a directive in the leading comments of a migration file, like `-- igmigrator:no-transaction`.
+const DirectivePrefix = "igmigrator:"
+
+// Directives are per file options set in the leading comments of a migration file.
+type Directives struct {
+	// NoTransaction runs the file outside of the migration transaction, set with `-- igmigrator:no-transaction`.
+	NoTransaction bool
+	// StatementTimeout overrides Config.StatementTimeout for the file, set with `-- igmigrator:statement-timeout 10m`.
+	StatementTimeout time.Duration
+}
+
+// ParseDirectives reads directives from the leading comment lines of a migration file.
+// Parsing stops at the first line which is not empty and not a `--` comment.
+func ParseDirectives(content []byte) (Directives, error) {
+	var directives Directives
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+
+		comment := strings.TrimSpace(strings.TrimPrefix(line, "--"))
+		if !strings.HasPrefix(comment, DirectivePrefix) {
+			continue
+		}
+
+		name, value, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(comment, DirectivePrefix)), " ")
+		value = strings.TrimSpace(value)
+
+		switch name {
+		case "no-transaction":
+			if value != "" {
+				return directives, fmt.Errorf("directive %q does not take a value", comment)
+			}
+
+			directives.NoTransaction = true
+		case "statement-timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return directives, fmt.Errorf("directive %q requires a positive duration like 10m", comment)
+			}
+
+			directives.StatementTimeout = timeout
+		default:
+			return directives, fmt.Errorf("unknown directive %q", comment)
+		}
+	}
+
+	return directives, scanner.Err()
+}
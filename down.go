@@ -0,0 +1,270 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// MigrateTo migrates a single directory up or down to the target version.
+//
+// Directory path is relative to the migrations directory, like `/` or `/test`.
+// Going down runs the paired down files (e.g. `5_add_col.down.sql` for `5_add_col.sql`)
+// from the latest applied version and removes their versions from migration table.
+// Versions equal to targetVersion are kept.
+//
+// Going up runs like Migrate limited to the directory and files up to the target version:
+// with the session lock, Config.MaxDuration, Config.BaselineVersion, hooks, callback files,
+// repeatable migrations and non-transactional files.
+// Going down only runs the down files, they cannot be non-transactional.
+func MigrateTo(ctx context.Context, db DB, cnf *Config, directoryPath string, targetVersion int) (*MigrateResult, error) {
+	return migrateToTarget(ctx, db, cnf, &migrateTarget{dir: cleanPath(directoryPath), version: targetVersion})
+}
+
+// MigrateToInTx is the same as MigrateTo but operates on the given transaction.
+//
+// Non-transactional migration files cannot run in this function and return an error.
+func MigrateToInTx(ctx context.Context, tx Transaction, cnf *Config, directoryPath string, targetVersion int) (*MigrateResult, error) {
+	return migrateToTargetInTx(ctx, tx, cnf, &migrateTarget{dir: cleanPath(directoryPath), version: targetVersion})
+}
+
+// MigrateDown reverts the latest steps migrations of a single directory.
+func MigrateDown(ctx context.Context, db DB, cnf *Config, directoryPath string, steps int) (*MigrateResult, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	return migrateToTarget(ctx, db, cnf, &migrateTarget{dir: cleanPath(directoryPath), steps: steps})
+}
+
+// MigrateDownInTx is the same as MigrateDown but operates on the given transaction.
+func MigrateDownInTx(ctx context.Context, tx Transaction, cnf *Config, directoryPath string, steps int) (*MigrateResult, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("steps must be positive, got %d", steps)
+	}
+
+	return migrateToTargetInTx(ctx, tx, cnf, &migrateTarget{dir: cleanPath(directoryPath), steps: steps})
+}
+
+// migrateTarget limits a run to a single directory, see MigrateTo and MigrateDown.
+type migrateTarget struct {
+	dir string
+	// version is the target version, files above it are not run and applied versions above it are reverted.
+	version int
+	// steps reverts the latest applied versions instead of migrating to version, if it is positive.
+	steps int
+}
+
+// migrateToTarget runs Migrate limited to the target.
+func migrateToTarget(ctx context.Context, db DB, cnf *Config, target *migrateTarget) (*MigrateResult, error) {
+	if cnf.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cnf.MaxDuration, ErrMaxDuration)
+
+		defer cancel()
+	}
+
+	var result *MigrateResult
+
+	err := withSessionLock(ctx, db, cnf, func(db DB, session bool) error {
+		var err error
+		result, err = migrate(ctx, db, cnf, session, target)
+
+		return err
+	})
+	if err != nil {
+		return nil, wrapMaxDuration(ctx, err)
+	}
+
+	return result, nil
+}
+
+// migrateToTargetInTx runs MigrateInTx limited to the target.
+func migrateToTargetInTx(ctx context.Context, tx Transaction, cnf *Config, target *migrateTarget) (*MigrateResult, error) {
+	if cnf.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cnf.MaxDuration, ErrMaxDuration)
+
+		defer cancel()
+	}
+
+	result := &MigrateResult{Path: make(map[string]MigrateResultVersion)}
+
+	if _, err := migrateInTx(ctx, tx, cnf, nil, result, "", target); err != nil {
+		return nil, wrapMaxDuration(ctx, err)
+	}
+
+	return result, nil
+}
+
+// targetDirs returns the directory of the target, or all directories without target.
+func (m *Migrator) targetDirs() ([]string, error) {
+	if m.target == nil {
+		return m.GetDirs()
+	}
+
+	return []string{m.target.dir}, nil
+}
+
+// belowTarget returns migration files up to the target version, all files without target.
+func (m *Migrator) belowTarget(migrations []string) []string {
+	if m.target == nil {
+		return migrations
+	}
+
+	for i, migration := range migrations {
+		// Files are sorted by version.
+		if VersionFromFile(path.Base(migration)) > m.target.version {
+			return migrations[:i]
+		}
+	}
+
+	return migrations
+}
+
+// revertTarget runs down migrations of the target directory and reports whether it is done.
+// It is not done if the directory is not above the target version, then it is migrated up.
+// A target of steps is always done, it never migrates up.
+//
+// Hooks, callback files and repeatable migrations do not run when going down.
+func (m *Migrator) revertTarget(ctx context.Context, result *MigrateResult) (bool, error) {
+	dir := m.target.dir
+
+	lastVersion, err := m.GetLastVersion(ctx, dir)
+	if err != nil {
+		return false, err
+	}
+
+	targetVersion := m.target.version
+	if m.target.steps > 0 {
+		versions, err := m.GetAppliedVersions(ctx, dir)
+		if err != nil {
+			return false, err
+		}
+
+		// Versions are sorted ascending, target is the version which stays as latest one.
+		targetVersion = 0
+		if len(versions) > m.target.steps {
+			targetVersion = versions[len(versions)-m.target.steps-1]
+		}
+	}
+
+	if targetVersion >= lastVersion {
+		if m.target.steps > 0 {
+			result.merge(&MigrateResult{Path: map[string]MigrateResultVersion{dir: {PrevVersion: lastVersion, NewVersion: lastVersion}}})
+		}
+
+		return m.target.steps > 0, nil
+	}
+
+	m.Logger.Info("current database version", "path", dir, "version", lastVersion, "target_version", targetVersion)
+
+	if err := m.revert(ctx, dir, targetVersion); err != nil {
+		return false, err
+	}
+
+	newVersion, err := m.GetLastVersion(ctx, dir)
+	if err != nil {
+		return false, err
+	}
+
+	result.merge(&MigrateResult{
+		Path:  map[string]MigrateResultVersion{dir: {PrevVersion: lastVersion, NewVersion: newVersion}},
+		Files: m.files,
+	})
+
+	return true, nil
+}
+
+// revert runs down migrations of all applied versions above targetVersion, latest first.
+func (m *Migrator) revert(ctx context.Context, dir string, targetVersion int) error {
+	versions, err := m.GetAppliedVersions(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	for i := len(versions) - 1; i >= 0 && versions[i] > targetVersion; i-- {
+		version := versions[i]
+
+		downFile, err := m.GetDownMigrationFile(path.Join(m.Cnf.MigrationsDir, dir), version)
+		if err != nil {
+			return err
+		}
+
+		filePath := path.Join(m.Cnf.MigrationsDir, dir, downFile)
+
+		start := time.Now()
+
+		checksum, rowsAffected, err := m.migrateDown(ctx, filePath)
+		if err != nil {
+			return m.newMigrationError(ctx, path.Join(dir, downFile), version, err)
+		}
+
+		duration := time.Since(start)
+
+		if err := m.DeleteVersion(ctx, dir, version); err != nil {
+			return err
+		}
+
+		m.files = append(m.files, AppliedMigration{
+			Path:         dir,
+			File:         path.Join(dir, downFile),
+			Name:         downFile,
+			Version:      version,
+			Down:         true,
+			Duration:     duration,
+			RowsAffected: rowsAffected,
+			Checksum:     checksum,
+		})
+
+		m.Logger.Info("success revert migration", "reverted", version, "path", dir, "migration_path", filePath)
+	}
+
+	return nil
+}
+
+// migrateDown runs the down migration file in the transaction and returns checksum of the file and affected rows.
+func (m *Migrator) migrateDown(ctx context.Context, filePath string) (string, int64, error) {
+	nonTransactional, err := m.isNonTransactional(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if nonTransactional {
+		return "", 0, errors.New("down migration cannot be non-transactional")
+	}
+
+	return m.migrateFile(ctx, filePath)
+}
+
+// GetDownMigrationFile returns name of the down migration file of the version.
+func (m *Migrator) GetDownMigrationFile(migrationDir string, version int) (string, error) {
+	files, err := m.readdir(migrationDir)
+	if err != nil {
+		return "", err
+	}
+
+	found := ""
+	for _, file := range files {
+		if file.IsDir() || !isDownMigrationFile(file.Name()) || VersionFromFile(file.Name()) != version {
+			continue
+		}
+
+		if found != "" {
+			return "", fmt.Errorf("multiple down migration files for version %d in %s: %s, %s", version, migrationDir, found, file.Name())
+		}
+
+		found = file.Name()
+	}
+
+	if found == "" {
+		return "", &sentinelError{
+			message:  fmt.Sprintf("down migration file for version %d not found in %s", version, migrationDir),
+			sentinel: ErrMissingFile,
+		}
+	}
+
+	return found, nil
+}
@@ -0,0 +1,149 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrator_GetMigrationFiles_SkipDown(t *testing.T) {
+	m := Migrator{Cnf: &Config{}}
+
+	files, err := m.GetMigrationFiles(testdata.Path("down"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_create_accounts.sql", "2_add_last_login.sql"}, files)
+
+	downFile, err := m.GetDownMigrationFile(testdata.Path("down"), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "2_add_last_login.down.sql", downFile)
+
+	_, err = m.GetDownMigrationFile(testdata.Path("down"), 3)
+	assert.EqualError(t, err, "down migration file for version 3 not found in "+testdata.Path("down"))
+	assert.ErrorIs(t, err, ErrMissingFile)
+}
+
+func TestMigrateTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		run    func(db DB, conf *Config) (*MigrateResult, error)
+		init   func(mck sqlmock.Sqlmock)
+		result MigrateResultVersion
+		files  []string
+	}{
+		{
+			name: "up_to_target",
+			run: func(db DB, conf *Config) (*MigrateResult, error) {
+				return MigrateTo(context.Background(), db, conf, "/", 1)
+			},
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				// Validate migration files against applied versions.
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				expectCurrentUser(mck)
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			result: MigrateResultVersion{PrevVersion: 0, NewVersion: 1},
+			files:  []string{"/1_create_accounts.sql"},
+		},
+		{
+			name: "down_to_target",
+			run: func(db DB, conf *Config) (*MigrateResult, error) {
+				return MigrateTo(context.Background(), db, conf, "/", 0)
+			},
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+				mck.ExpectExec("ALTER TABLE accounts DROP COLUMN last_login").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("DELETE FROM migration WHERE path = \\$1 AND version = \\$2").WithArgs("/", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mck.ExpectExec("DROP TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("DELETE FROM migration WHERE path = \\$1 AND version = \\$2").WithArgs("/", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+			},
+			result: MigrateResultVersion{PrevVersion: 2, NewVersion: 0},
+			files:  []string{"/2_add_last_login.down.sql", "/1_create_accounts.down.sql"},
+		},
+		{
+			name: "down_steps",
+			run: func(db DB, conf *Config) (*MigrateResult, error) {
+				return MigrateDown(context.Background(), db, conf, "/", 1)
+			},
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+				mck.ExpectExec("ALTER TABLE accounts DROP COLUMN last_login").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("DELETE FROM migration WHERE path = \\$1 AND version = \\$2").WithArgs("/", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+			},
+			result: MigrateResultVersion{PrevVersion: 2, NewVersion: 1},
+			files:  []string{"/2_add_last_login.down.sql"},
+		},
+	}
+
+	for _, scenario := range tests {
+		t.Run(scenario.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			expectPrepareDB(mck, "migration")
+			scenario.init(mck)
+			mck.ExpectCommit()
+
+			conf := &Config{MigrationsDir: testdata.Path("down")}
+
+			result, err := scenario.run(db, conf)
+			require.NoError(t, err)
+			require.Equal(t, scenario.result, result.Path["/"])
+			require.NoError(t, mck.ExpectationsWereMet())
+
+			var files []string
+			for _, file := range result.Files {
+				assert.Equal(t, scenario.result.NewVersion < scenario.result.PrevVersion, file.Down)
+				assert.Equal(t, VersionFromFile(file.Name), file.Version)
+				files = append(files, file.File)
+			}
+
+			assert.Equal(t, scenario.files, files)
+		})
+	}
+}
+
+func TestMigrateTo_MigrationError(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	driverErr := errors.New(`column "last_login" does not exist`)
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+	mck.ExpectExec("ALTER TABLE accounts DROP COLUMN last_login").WillReturnError(driverErr)
+	mck.ExpectRollback()
+
+	_, err = MigrateTo(context.Background(), db, &Config{MigrationsDir: testdata.Path("down")}, "/", 1)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	var migrationErr *MigrationError
+	require.ErrorAs(t, err, &migrationErr)
+	assert.Equal(t, "/", migrationErr.Path)
+	assert.Equal(t, 2, migrationErr.Version)
+	assert.ErrorIs(t, err, driverErr)
+	assert.EqualError(t, err, `failed down migration on testdata/down/2_add_last_login.down.sql version 2: column "last_login" does not exist`)
+}
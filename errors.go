@@ -0,0 +1,149 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrMaxDuration is returned when a migration is stopped because Config.MaxDuration is exceeded.
+	ErrMaxDuration = errors.New("migration max duration exceeded")
+	// ErrLockTimeout matches LockTimeoutError, returned when the migration lock is not acquired in Config.LockTimeout.
+	ErrLockTimeout = errors.New("migration lock timeout")
+	// ErrChecksumMismatch is returned when an applied migration file has been changed.
+	ErrChecksumMismatch = errors.New("migration checksum mismatch")
+	// ErrMissingFile is returned when a migration file is not found, like an applied version without file
+	// or a version without down migration file.
+	ErrMissingFile = errors.New("migration file missing")
+	// ErrUndefinedVariable is returned when a migration file uses a variable without default value
+	// which is not in Config.Values.
+	ErrUndefinedVariable = errors.New("undefined variable")
+	// ErrUpgradeRequired is returned by Status, Validate and Plan for a migration table without the path column
+	// and by History for a migration table of an older layout, which is upgraded by the next Migrate.
+	ErrUpgradeRequired = errors.New("migration table needs upgrade")
+)
+
+// MigrationError is returned when a migration, down migration, repeatable migration or callback file fails.
+//
+// Err is the error of the driver, like *pgconn.PgError with SQLSTATE, and can be reached with errors.As.
+type MigrationError struct {
+	// Path is the directory of the migration, like `/` or `/test`.
+	Path string
+	File string
+	Name string
+	// Version is 0 for repeatable migrations and callbacks.
+	Version int
+	// Statement is the failed SQL, empty for Go migrations and errors before execution.
+	Statement string
+	// Line and Column locate the error in the migration file before variables are replaced, 1-based.
+	// For templates they locate the error in the rendered SQL.
+	// They are set if the driver reports the position of the error, like *pgconn.PgError of pgx and *pq.Error of lib/pq,
+	// otherwise they are 0.
+	Line   int
+	Column int
+	// Source is the failed line of the file with a few lines around it, numbered.
+	Source string
+	Err    error
+
+	// dir is Config.MigrationsDir, the message has the path of the file with it.
+	dir string
+}
+
+func (e *MigrationError) Error() string {
+	file := path.Join(e.dir, e.File)
+	if e.Line > 0 {
+		file = fmt.Sprintf("%s:%d:%d", file, e.Line, e.Column)
+	}
+
+	switch name := e.Name; {
+	case isCallback(name):
+		return fmt.Sprintf("failed callback %s: %v", file, e.Err)
+	case strings.HasPrefix(name, RepeatablePrefix):
+		return fmt.Sprintf("failed repeatable migration on %s: %v", file, e.Err)
+	case isDownMigrationFile(name):
+		return fmt.Sprintf("failed down migration on %s version %d: %v", file, e.Version, e.Err)
+	}
+
+	return fmt.Sprintf("failed migration on %s version %d: %v", file, e.Version, e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// execError is the error of an executed statement, it is unwrapped to MigrationError.Statement.
+type execError struct {
+	statement string
+	// source, expansion and offset of the statement in expansion.text locate the statement in the file.
+	source    string
+	expansion *expansion
+	offset    int
+	err       error
+}
+
+func (e *execError) Error() string {
+	return e.err.Error()
+}
+
+func (e *execError) Unwrap() error {
+	return e.err
+}
+
+// newMigrationError returns MigrationError of the file relative to the migrations directory.
+// Errors caused by Config.MaxDuration also wrap ErrMaxDuration.
+func (m *Migrator) newMigrationError(ctx context.Context, fileName string, version int, err error) *MigrationError {
+	migrationErr := &MigrationError{
+		Path:    getPath(fileName),
+		File:    fileName,
+		Name:    path.Base(fileName),
+		Version: version,
+		Err:     err,
+		dir:     m.Cnf.MigrationsDir,
+	}
+
+	if execErr, ok := err.(*execError); ok {
+		migrationErr.Statement = execErr.statement
+		migrationErr.Line, migrationErr.Column, migrationErr.Source = execErr.location()
+		migrationErr.Err = execErr.err
+	}
+
+	if maxDurationExceeded(ctx) {
+		m.Logger.Error("migration max duration exceeded", "max_duration", m.Cnf.MaxDuration.String(), "migration_path", path.Join(migrationErr.dir, migrationErr.File))
+
+		migrationErr.Err = fmt.Errorf("%w: %w", ErrMaxDuration, migrationErr.Err)
+	}
+
+	if migrationErr.Line > 0 {
+		m.Logger.Error("failed migration", "migration_path", path.Join(migrationErr.dir, migrationErr.File), "version", version,
+			"line", migrationErr.Line, "column", migrationErr.Column, "source", migrationErr.Source)
+	}
+
+	return migrationErr
+}
+
+// wrapMaxDuration wraps err with ErrMaxDuration if Config.MaxDuration is exceeded,
+// like errors of the lock, hooks and the migration table upgrade which are not a MigrationError.
+func wrapMaxDuration(ctx context.Context, err error) error {
+	if errors.Is(err, ErrMaxDuration) || !maxDurationExceeded(ctx) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrMaxDuration, err)
+}
+
+// sentinelError keeps its message and matches the sentinel error with errors.Is.
+type sentinelError struct {
+	message  string
+	sentinel error
+}
+
+func (e *sentinelError) Error() string {
+	return e.message
+}
+
+func (e *sentinelError) Unwrap() error {
+	return e.sentinel
+}
@@ -0,0 +1,81 @@
+package igmigrator
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrate_MigrationError(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	content, err := os.ReadFile(testdata.Path("locking", "1_install_table.sql"))
+	require.NoError(t, err)
+
+	pgErr := &pgconn.PgError{Severity: "ERROR", Code: "42P07", Message: `relation "accounts" already exists`}
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnError(pgErr)
+	mck.ExpectRollback()
+
+	_, err = Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("locking")})
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	var migrationErr *MigrationError
+	require.ErrorAs(t, err, &migrationErr)
+	assert.Equal(t, &MigrationError{
+		Path:      "/",
+		File:      "/1_install_table.sql",
+		Name:      "1_install_table.sql",
+		Version:   1,
+		Statement: string(content),
+		Err:       pgErr,
+		dir:       testdata.Path("locking"),
+	}, migrationErr)
+	assert.EqualError(t, err, `failed migration on testdata/locking/1_install_table.sql version 1: ERROR: relation "accounts" already exists (SQLSTATE 42P07)`)
+
+	var driverErr *pgconn.PgError
+	require.ErrorAs(t, err, &driverErr)
+	assert.Equal(t, "42P07", driverErr.Code)
+}
+
+func TestMigrator_CheckDir_ChecksumMismatch(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx:     db,
+		Cnf:    &Config{MigrationsDir: testdata.Path("normal"), MigrationTable: "migration"},
+		Logger: logz.AdapterNoop{},
+	}
+
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2).AddRow(3))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(2, "abc"))
+
+	err = m.checkDir(context.Background(), "/")
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	assert.NotErrorIs(t, err, ErrMissingFile)
+	assert.ErrorContains(t, err, "checksum mismatch on /2_install_pos.sql version 2: applied abc")
+}
@@ -0,0 +1,51 @@
+package igmigrator
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HookFunc is called in the migration transaction, like Config.BeforeAll.
+type HookFunc func(ctx context.Context, tx Transaction) error
+
+// MigrationHookFunc is called in the migration transaction for a single migration.
+type MigrationHookFunc func(ctx context.Context, tx Transaction, migration MigrationInfo) error
+
+// ResultHookFunc is called in the migration transaction with the result of the run.
+type ResultHookFunc func(ctx context.Context, tx Transaction, result *MigrateResult) error
+
+// MigrationInfo describes a single migration passed to hooks.
+type MigrationInfo struct {
+	// Path is the directory of the migration, like `/test`.
+	Path    string
+	File    string
+	Name    string
+	Version int
+	// Duration of the migration, zero before the migration runs.
+	Duration time.Duration
+}
+
+func (m *Migrator) beforeMigration(ctx context.Context, info MigrationInfo) error {
+	if m.Cnf.BeforeMigration == nil {
+		return nil
+	}
+
+	if err := m.Cnf.BeforeMigration(ctx, m.Tx, info); err != nil {
+		return fmt.Errorf("before migration hook on %s version %d: %w", info.File, info.Version, err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) afterMigration(ctx context.Context, info MigrationInfo) error {
+	if m.Cnf.AfterMigration == nil {
+		return nil
+	}
+
+	if err := m.Cnf.AfterMigration(ctx, m.Tx, info); err != nil {
+		return fmt.Errorf("after migration hook on %s version %d: %w", info.File, info.Version, err)
+	}
+
+	return nil
+}
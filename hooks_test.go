@@ -0,0 +1,90 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrateInTx_Hooks(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	expectPrepareDB(mck, "migration")
+	mck.ExpectExec("SET LOCAL role migrator").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("GRANT SELECT ON ALL TABLES IN SCHEMA public TO reader").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("REFRESH MATERIALIZED VIEW account_stats").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var calls []string
+
+	_, err = MigrateInTx(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		BeforeAll: func(ctx context.Context, tx Transaction) error {
+			calls = append(calls, "before all")
+			_, err := tx.ExecContext(ctx, "SET LOCAL role migrator")
+
+			return err
+		},
+		BeforeMigration: func(_ context.Context, _ Transaction, migration MigrationInfo) error {
+			calls = append(calls, "before "+migration.File)
+			assert.Zero(t, migration.Duration)
+
+			return nil
+		},
+		AfterMigration: func(ctx context.Context, tx Transaction, migration MigrationInfo) error {
+			calls = append(calls, "after "+migration.File)
+			assert.Equal(t, MigrationInfo{Path: "/", File: "/1_install_table.sql", Name: "1_install_table.sql", Version: 1, Duration: migration.Duration}, migration)
+			assert.Positive(t, migration.Duration)
+			_, err := tx.ExecContext(ctx, "GRANT SELECT ON ALL TABLES IN SCHEMA public TO reader")
+
+			return err
+		},
+		AfterAll: func(ctx context.Context, tx Transaction, result *MigrateResult) error {
+			calls = append(calls, "after all")
+			assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 1}, result.Path["/"])
+			_, err := tx.ExecContext(ctx, "REFRESH MATERIALIZED VIEW account_stats")
+
+			return err
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+	assert.Equal(t, []string{"before all", "before /1_install_table.sql", "after /1_install_table.sql", "after all"}, calls)
+}
+
+func TestMigrateInTx_HookError(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+
+	_, err = MigrateInTx(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		BeforeMigration: func(context.Context, Transaction, MigrationInfo) error {
+			return errors.New("not allowed")
+		},
+	})
+	require.EqualError(t, err, "before migration hook on /1_install_table.sql version 1: not allowed")
+	require.NoError(t, mck.ExpectationsWereMet())
+}
@@ -1,18 +1,26 @@
+// Package igmigrator runs versioned SQL migration files of a directory and its subdirectories.
+//
+// File fields of the reported types, like MigrationInfo, PlannedMigration, MigrationRecord, AppliedMigration,
+// ChecksumMismatch, MigrationError and TemplateData, are paths relative to the migrations directory,
+// like `/test/1_create.sql`. Name fields are the file names, like `1_create.sql`.
 package igmigrator
 
 import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -21,11 +29,15 @@ import (
 
 var DefaultSkipDirs = []string{"archive"}
 
+// DownMigrationSuffix is the suffix of down migration files, like `5_add_col.down.sql` for `5_add_col.sql`.
+const DownMigrationSuffix = ".down.sql"
+
 // DefaultMigrationFileSkipper defines default behavior for skipping migration files.
-// File will be skipped if it is a directory, does not have suffix ".sql" or does not have version suffix.
+// File will be skipped if it is a directory, does not have suffix ".sql" or ".sql.tmpl", is a down migration
+// or does not have version suffix.
 func DefaultMigrationFileSkipper(file fs.DirEntry, currentVersion int) bool {
 	fileName := file.Name()
-	if file.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+	if file.IsDir() || !isSQLFile(fileName) || isDownMigrationFile(fileName) {
 		return true
 	}
 
@@ -44,20 +56,62 @@ type DB interface {
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
-// Transaction holds related database methods.
+// Transaction holds related database methods, implemented by *sql.Tx, *sql.DB and *sql.Conn.
 type Transaction interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 }
 
 type Migrator struct {
 	Cnf    *Config
 	Tx     Transaction
 	Logger logz.Adapter
+	// DB is the plain database connection used for non-transactional migrations.
+	// It is nil in MigrateInTx.
+	DB DB
+
+	// nonTransactional is the pending non-transactional migration file which stopped the run.
+	nonTransactional string
+	callbacks        map[string]Callbacks
+	// target limits the run to a single directory, nil in Migrate.
+	target *migrateTarget
+	// records are migrations recorded by this migrator.
+	records []MigrationRecord
+	// files are migration files run by this migrator.
+	files []AppliedMigration
+	// appliedBy is the database user, read once before the first record.
+	appliedBy *string
+	// layout is the older layout version of the migration table found by reads without upgrade,
+	// 0 if the table has the latest layout.
+	layout int
 }
 
 type MigrateResult struct {
 	Path map[string]MigrateResultVersion
+	// Records are rows added to the migration table, in the order of execution.
+	// Versions recorded by Config.BaselineVersion and versions removed by down migrations are not included.
+	Records []MigrationRecord
+	// Files are migration files run, in the order of execution, including repeatable and down migrations.
+	Files []AppliedMigration
+}
+
+// AppliedMigration is a migration file run by Migrate, MigrateTo or MigrateDown.
+type AppliedMigration struct {
+	// Path is the directory of the file, like `/` or `/test`.
+	Path string
+	File string
+	Name string
+	// Version is 0 for repeatable migrations.
+	Version int
+	// Down is set for down migrations, their version is removed from the migration table.
+	Down     bool
+	Duration time.Duration
+	// RowsAffected is reported by the driver. For a file with multiple statements it is usually of the last statement,
+	// with Config.SplitStatements it is the sum of all statements. It is 0 for Go migrations and drivers which do not report it.
+	RowsAffected int64
+	// Checksum is the checksum of the file content, empty for Go migrations.
+	Checksum string
 }
 
 type MigrateResultVersion struct {
@@ -70,8 +124,126 @@ type MigrateResultVersion struct {
 // This function should receive plain database connection, not transaction!
 // If transaction should be used - use MigrateInTx
 //
+// Migrations run in a single transaction. When a non-transactional migration file is reached,
+// the transaction is committed, the file runs on db and remaining migrations continue in a new transaction.
+//
 // This function returns version before and after migration.
 func Migrate(ctx context.Context, db DB, cnf *Config) (*MigrateResult, error) {
+	if cnf.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cnf.MaxDuration, ErrMaxDuration)
+
+		defer cancel()
+	}
+
+	var result *MigrateResult
+
+	err := withSessionLock(ctx, db, cnf, func(db DB, session bool) error {
+		var err error
+		result, err = migrate(ctx, db, cnf, session, nil)
+
+		return err
+	})
+	if err != nil {
+		return nil, wrapMaxDuration(ctx, err)
+	}
+
+	return result, nil
+}
+
+// migrate runs transactions of Migrate, session is true if db is a connection holding the session lock.
+// If target is not nil, only the target directory is migrated, see MigrateTo.
+func migrate(ctx context.Context, db DB, cnf *Config, session bool, target *migrateTarget) (*MigrateResult, error) {
+	result := &MigrateResult{Path: make(map[string]MigrateResultVersion)}
+
+	// Lock of a transaction excludes other migrations while the non-transactional file runs on db,
+	// so it needs a second connection of the pool.
+	// With the session lock, or without any lock like SQLite, the file runs directly on the connection.
+	runNonTransactional := inTx
+	if session || !takesLock(cnf.locker()) {
+		runNonTransactional = onConn
+	}
+
+	// Directory of the last non-transactional migration, it continues in the next transaction.
+	var continuedDir string
+
+	for {
+		var nonTransactional string
+
+		err := inTx(ctx, db, func(tx Transaction) error {
+			var err error
+			nonTransactional, err = migrateInTx(ctx, tx, cnf, db, result, continuedDir, target)
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if nonTransactional == "" {
+			return result, nil
+		}
+
+		var (
+			records []MigrationRecord
+			files   []AppliedMigration
+		)
+
+		err = runNonTransactional(ctx, db, func(tx Transaction) error {
+			migration, err := newMigrator(ctx, tx, cnf)
+			if err != nil {
+				return err
+			}
+
+			migration.DB = db
+
+			if err := migration.migrateNonTransactional(ctx, nonTransactional); err != nil {
+				return err
+			}
+
+			records, files = migration.records, migration.files
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		continuedDir = getPath(nonTransactional)
+
+		result.merge(&MigrateResult{
+			Path: map[string]MigrateResultVersion{
+				continuedDir: {NewVersion: VersionFromFile(path.Base(nonTransactional))},
+			},
+			Records: records,
+			Files:   files,
+		})
+	}
+}
+
+// merge adds versions, records and files of other to the result, keeping the first previous version and the highest new version.
+func (r *MigrateResult) merge(other *MigrateResult) {
+	r.Records = append(r.Records, other.Records...)
+	r.Files = append(r.Files, other.Files...)
+
+	for dir, version := range other.Path {
+		current, ok := r.Path[dir]
+		if !ok {
+			r.Path[dir] = version
+
+			continue
+		}
+
+		if version.NewVersion > current.NewVersion {
+			current.NewVersion = version.NewVersion
+		}
+
+		r.Path[dir] = current
+	}
+}
+
+// inTx runs fn in a new transaction and commits it if fn does not return error.
+func inTx(ctx context.Context, db DB, fn func(tx Transaction) error) error {
 	var tx interface {
 		Transaction
 		driver.Tx
@@ -79,33 +251,48 @@ func Migrate(ctx context.Context, db DB, cnf *Config) (*MigrateResult, error) {
 
 	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	result, err := MigrateInTx(ctx, tx, cnf)
-	if err != nil {
-		if rollbackErr := tx.Rollback(); rollbackErr != nil {
-			return nil, fmt.Errorf("%w, also rollback error: %s", err, rollbackErr.Error())
+	if err := fn(tx); err != nil {
+		// Transaction is already rolled back if the context is done.
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && !errors.Is(rollbackErr, sql.ErrTxDone) {
+			return fmt.Errorf("%w, also rollback error: %s", err, rollbackErr.Error())
 		}
 
-		return nil, err
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, err
+	return tx.Commit()
+}
+
+// onConn runs fn directly on db without a transaction, if db can run queries.
+func onConn(ctx context.Context, db DB, fn func(tx Transaction) error) error {
+	conn, ok := db.(Transaction)
+	if !ok {
+		return inTx(ctx, db, fn)
 	}
 
-	return result, nil
+	return fn(conn)
 }
 
-// MigrateInTx will run SQL files in sequence till the latest version. Generally Migrate should be used instead.
-//
-// This function MUST operate on transaction! If plain database connection will be provided - it will return error.
-// This function will do only DB queries, which means that no transaction stuff will be used.
-func MigrateInTx(ctx context.Context, tx Transaction, cnf *Config) (*MigrateResult, error) {
+// inReadTx runs fn in a new transaction which is always rolled back.
+func inReadTx(ctx context.Context, db DB, fn func(tx Transaction) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback() //nolint:errcheck // nothing to commit
+
+	return fn(tx)
+}
+
+// newMigrator sanitizes the configuration and returns migrator with switched schema.
+func newMigrator(ctx context.Context, tx Transaction, cnf *Config) (*Migrator, error) {
 	cnf.Sanitize()
 
-	migration := Migrator{
+	migration := &Migrator{
 		Cnf:    cnf,
 		Tx:     tx,
 		Logger: cnf.Logger,
@@ -123,65 +310,192 @@ func MigrateInTx(ctx context.Context, tx Transaction, cnf *Config) (*MigrateResu
 		return nil, err
 	}
 
+	return migration, nil
+}
+
+// MigrateInTx will run SQL files in sequence till the latest version. Generally Migrate should be used instead.
+//
+// This function MUST operate on transaction! If plain database connection will be provided - it will return error.
+// This function will do only DB queries, which means that no transaction stuff will be used.
+//
+// Non-transactional migration files cannot run in this function and return an error.
+func MigrateInTx(ctx context.Context, tx Transaction, cnf *Config) (*MigrateResult, error) {
+	if cnf.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cnf.MaxDuration, ErrMaxDuration)
+
+		defer cancel()
+	}
+
+	result := &MigrateResult{Path: make(map[string]MigrateResultVersion)}
+
+	if _, err := migrateInTx(ctx, tx, cnf, nil, result, "", nil); err != nil {
+		return nil, wrapMaxDuration(ctx, err)
+	}
+
+	return result, nil
+}
+
+// migrateInTx runs migrations till the latest version or till the first non-transactional migration file
+// and merges versions into result. If it stops on a non-transactional file, name of the file is returned.
+//
+// continuedDir is the directory of the non-transactional migration run before this transaction, empty in the first one.
+// Config.BeforeAll is called in the first transaction, Config.AfterAll is called when all migrations are done.
+// Non-transactional files are only allowed if db is not nil.
+//
+// With a target, only its directory is migrated up to the target version. If the directory is above the target version,
+// it is reverted instead, see revertTarget.
+func migrateInTx(ctx context.Context, tx Transaction, cnf *Config, db DB, result *MigrateResult, continuedDir string, target *migrateTarget) (string, error) {
+	migration, err := newMigrator(ctx, tx, cnf)
+	if err != nil {
+		return "", err
+	}
+
+	migration.DB = db
+	migration.target = target
+
 	if err := migration.prepareDB(ctx); err != nil {
-		return nil, err
+		return "", err
+	}
+
+	if continuedDir == "" && target != nil {
+		reverted, err := migration.revertTarget(ctx, result)
+		if err != nil || reverted {
+			return "", err
+		}
+	}
+
+	if continuedDir == "" && cnf.BaselineVersion > 0 {
+		if err := migration.baselineEmpty(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	if continuedDir == "" && cnf.BeforeAll != nil {
+		if err := cnf.BeforeAll(ctx, tx); err != nil {
+			return "", fmt.Errorf("before all hook: %w", err)
+		}
 	}
 
-	// get dirs
-	dirs, err := migration.GetDirs()
+	dirs, err := migration.targetDirs()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	result := &MigrateResult{Path: make(map[string]MigrateResultVersion)}
+	partResult := &MigrateResult{Path: make(map[string]MigrateResultVersion)}
 	for _, dir := range dirs {
-		previousVersion, newVersion, err := migrateInTxDir(ctx, &migration, dir)
+		previousVersion, newVersion, err := migrateInTxDir(ctx, migration, dir, dir == continuedDir)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
-		result.Path[dir] = MigrateResultVersion{
+		partResult.Path[dir] = MigrateResultVersion{
 			PrevVersion: previousVersion,
 			NewVersion:  newVersion,
 		}
+
+		// Next directories wait for the non-transactional file to keep the order.
+		if migration.nonTransactional != "" {
+			break
+		}
 	}
 
-	return result, nil
+	partResult.Records, partResult.Files = migration.records, migration.files
+	result.merge(partResult)
+
+	if migration.nonTransactional == "" && cnf.AfterAll != nil {
+		if err := cnf.AfterAll(ctx, tx, result); err != nil {
+			return "", fmt.Errorf("after all hook: %w", err)
+		}
+	}
+
+	return migration.nonTransactional, nil
 }
 
-func migrateInTxDir(ctx context.Context, m *Migrator, dir string) (int, int, error) {
-	lastVersion, err := m.GetLastVersion(ctx, dir)
-	if err != nil {
+// migrateInTxDir runs pending migrations of the directory, continued is true if a non-transactional migration
+// of the directory run just before this transaction.
+func migrateInTxDir(ctx context.Context, m *Migrator, dir string, continued bool) (int, int, error) {
+	if err := m.checkDir(ctx, dir); err != nil {
 		return 0, 0, err
 	}
 
+	lastVersion, migrations, err := m.pendingMigrations(ctx, dir, true)
+	if err != nil {
+		return lastVersion, lastVersion, err
+	}
+
+	migrations = m.belowTarget(migrations)
+
+	repeatables, err := m.pendingRepeatables(ctx, dir, true)
+	if err != nil {
+		return lastVersion, lastVersion, err
+	}
+
 	m.Logger.Info("current database version", "path", dir, "version", lastVersion)
 
-	migrations, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), lastVersion)
-	if err != nil || len(migrations) == 0 { // Exit early if nothing to do
+	// Exit early if nothing to do, continued directory still runs its after all callback.
+	if len(migrations) == 0 && len(repeatables) == 0 && !continued {
 		m.Logger.Info("database is up to date", "path", dir)
 
+		return lastVersion, lastVersion, nil
+	}
+
+	newVersion, err := m.migrateDir(ctx, dir, migrations, repeatables, lastVersion, continued)
+	if err != nil {
 		return lastVersion, lastVersion, err
 	}
 
-	for i := range migrations {
-		migrations[i] = path.Join(dir, migrations[i])
+	return lastVersion, newVersion, nil
+}
+
+// pendingMigrations returns current version of the directory and migration files above it.
+// With Config.AllowOutOfOrder, not applied files below the current version are also returned.
+// Files are joined with the directory path, relative to the migrations directory.
+//
+// If tableExists is false, migration table is not queried and version is 0.
+func (m *Migrator) pendingMigrations(ctx context.Context, dir string, tableExists bool) (int, []string, error) {
+	lastVersion := 0
+	if tableExists {
+		var err error
+		if lastVersion, err = m.GetLastVersion(ctx, dir); err != nil {
+			return 0, nil, err
+		}
 	}
 
-	// Lock migration table to avoid race condition.
-	if err := m.AcquireLock(ctx); err != nil {
-		return lastVersion, lastVersion, err
+	if !m.Cnf.AllowOutOfOrder || lastVersion == 0 {
+		migrations, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), lastVersion)
+		if err != nil {
+			return lastVersion, nil, err
+		}
+
+		for i := range migrations {
+			migrations[i] = path.Join(dir, migrations[i])
+		}
+
+		return lastVersion, migrations, nil
 	}
 
-	newVersion, err := m.MigrateMultiple(ctx, migrations, lastVersion)
+	applied, err := m.GetAppliedVersions(ctx, dir)
 	if err != nil {
-		return lastVersion, lastVersion, err
+		return lastVersion, nil, err
 	}
 
-	return lastVersion, newVersion, nil
+	files, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), -1)
+	if err != nil {
+		return lastVersion, nil, err
+	}
+
+	migrations := make([]string, 0, len(files))
+	for _, file := range files {
+		if !slices.Contains(applied, VersionFromFile(file)) {
+			migrations = append(migrations, path.Join(dir, file))
+		}
+	}
+
+	return lastVersion, migrations, nil
 }
 
-// prepareDB creates migration table and locks it
+// prepareDB creates migration table, locks it and upgrades its layout.
 // Migration table will be unlocked when transaction will be committed/rolled back.
 func (m *Migrator) prepareDB(ctx context.Context) error {
 	// Create the migration table, if not present
@@ -189,9 +503,22 @@ func (m *Migrator) prepareDB(ctx context.Context) error {
 		return err
 	}
 
-	// Migrate versions of igmigrator itself
+	// Tables are created before the lock, DDL commits the transaction in MySQL and releases its lock.
+	if err := m.CreateMetadataTable(ctx); err != nil {
+		return err
+	}
 
-	return nil
+	if err := m.createRepeatableTable(ctx); err != nil {
+		return err
+	}
+
+	// Lock before any version is read to avoid race condition.
+	if err := m.AcquireLock(ctx); err != nil {
+		return err
+	}
+
+	// Upgrade the migration table of previous igmigrator versions.
+	return m.upgradeMetadata(ctx)
 }
 
 func (m *Migrator) addPreFolders(dirs []string) []string {
@@ -232,6 +559,8 @@ func (m *Migrator) addPreFolders(dirs []string) []string {
 // GetMigrationFiles will return sorted slice of migration files that should be executed.
 // By default, it will not include any migrations that are below current version,
 // but this behavior could be changed by changing MigrationFileSkipper.
+//
+// Go migrations registered for the directory are merged as `<version>.go`.
 func (m *Migrator) GetMigrationFiles(migrationDir string, lastVersion int) ([]string, error) {
 	files, err := m.readdir(migrationDir)
 	if err != nil {
@@ -248,15 +577,23 @@ func (m *Migrator) GetMigrationFiles(migrationDir string, lastVersion int) ([]st
 		versionFiles = append(versionFiles, file.Name())
 	}
 
+	versionFiles = append(versionFiles, registeredMigrations(m.relativeDir(migrationDir), lastVersion)...)
+
+	// Files with the same version are sorted by name to keep the order stable.
 	sort.Slice(versionFiles, func(i, j int) bool {
-		return VersionFromFile(versionFiles[i]) < VersionFromFile(versionFiles[j])
+		vi, vj := VersionFromFile(versionFiles[i]), VersionFromFile(versionFiles[j])
+		if vi == vj {
+			return versionFiles[i] < versionFiles[j]
+		}
+
+		return vi < vj
 	})
 
 	return versionFiles, nil
 }
 
-// SetSchema will switch current search_path to one specified in configuration.
-// If schema name is empty after trimming - it is no-op.
+// SetSchema will switch current schema(search_path in PostgreSQL) to one specified in configuration.
+// If schema name is empty after trimming or dialect does not support it - it is no-op.
 func (m *Migrator) SetSchema(ctx context.Context) error {
 	trimmed := strings.TrimSpace(m.Cnf.Schema)
 
@@ -264,33 +601,116 @@ func (m *Migrator) SetSchema(ctx context.Context) error {
 		return nil
 	}
 
-	_, err := m.Tx.ExecContext(ctx, "set local search_path = "+trimmed)
+	query := m.Dialect().SetSchema(trimmed)
+	if query == "" {
+		return nil
+	}
+
+	_, err := m.Tx.ExecContext(ctx, query)
 
 	return err
 }
 
 // MigrateMultiple runs all the migrations provided in migrations slice.
 // After each successful migration new version will be inserted in migration table.
+// Registered Go migrations (`<version>.go`) are called with the same transaction.
 //
-// This method will call Config.AfterSingleMigrationFunc after each successful migration.
+// This method will call Config.BeforeMigration before and Config.AfterMigration after each successful migration.
 func (m *Migrator) MigrateMultiple(ctx context.Context, migrations []string, lastVersion int) (int, error) {
 	newVersion := lastVersion
 
 	for _, fileName := range migrations {
 		filePath := path.Join(m.Cnf.MigrationsDir, fileName)
-		newVersion = VersionFromFile(filepath.Base(fileName))
+		version := VersionFromFile(filepath.Base(fileName))
+
+		fn, isGoMigration := registeredMigration(fileName)
+		if !isGoMigration {
+			nonTransactional, err := m.isNonTransactional(filePath)
+			if err != nil {
+				return lastVersion, m.newMigrationError(ctx, fileName, version, err)
+			}
+
+			if nonTransactional {
+				if m.DB == nil {
+					return lastVersion, m.newMigrationError(ctx, fileName, version, errors.New("non-transactional migration requires Migrate with database connection"))
+				}
+
+				// Stop here, the file runs after the current transaction is committed.
+				m.nonTransactional = fileName
 
-		if err := m.MigrateSingle(ctx, filePath); err != nil {
-			return lastVersion, fmt.Errorf("failed migration on %s version %d: %w", filePath, newVersion, err)
+				return newVersion, nil
+			}
 		}
 
-		directoryPath := getPath(fileName)
-		if err := m.InsertNewVersion(ctx, directoryPath, newVersion); err != nil {
+		info := MigrationInfo{Path: getPath(fileName), File: fileName, Name: path.Base(fileName), Version: version}
+		if err := m.beforeMigration(ctx, info); err != nil {
 			return lastVersion, err
 		}
 
+		callbacks, err := m.getCallbacks(info.Path)
+		if err != nil {
+			return lastVersion, err
+		}
+
+		if err := m.runCallback(ctx, callbacks.BeforeEach); err != nil {
+			return lastVersion, err
+		}
+
+		var (
+			checksum     string
+			rowsAffected int64
+		)
+
+		start := time.Now()
+
+		if isGoMigration {
+			err = fn(ctx, m.Tx)
+		} else {
+			checksum, rowsAffected, err = m.migrateFile(ctx, filePath)
+		}
+
+		info.Duration = time.Since(start)
+
+		if err != nil {
+			return lastVersion, m.newMigrationError(ctx, fileName, version, err)
+		}
+
+		if err := m.InsertRecord(ctx, &MigrationRecord{
+			Path:     info.Path,
+			Version:  version,
+			Checksum: checksum,
+			File:     fileName,
+			Name:     path.Base(fileName),
+			Duration: info.Duration,
+		}); err != nil {
+			return lastVersion, err
+		}
+
+		m.files = append(m.files, AppliedMigration{
+			Path:         info.Path,
+			File:         fileName,
+			Name:         path.Base(fileName),
+			Version:      version,
+			Duration:     info.Duration,
+			RowsAffected: rowsAffected,
+			Checksum:     checksum,
+		})
+
+		if err := m.runCallback(ctx, callbacks.AfterEach); err != nil {
+			return lastVersion, err
+		}
+
+		if err := m.afterMigration(ctx, info); err != nil {
+			return lastVersion, err
+		}
+
+		// Out of order migrations do not decrease the version.
+		if version > newVersion {
+			newVersion = version
+		}
+
 		// This single migrations should not be point of interest in most cases.
-		m.Logger.Info("success run migration", "migrated_to", newVersion, "path", directoryPath, "migration_path", filePath)
+		m.Logger.Info("success run migration", "migrated_to", version, "path", info.Path, "migration_path", filePath)
 	}
 
 	return newVersion, nil
@@ -299,65 +719,363 @@ func (m *Migrator) MigrateMultiple(ctx context.Context, migrations []string, las
 // MigrateSingle executes a single migration.
 // It does not increase version in migration table.
 func (m *Migrator) MigrateSingle(ctx context.Context, filePath string) error {
+	_, _, err := m.migrateFile(ctx, filePath)
+
+	return err
+}
+
+// migrateFile executes a single migration and returns checksum of the file and affected rows reported by the driver.
+func (m *Migrator) migrateFile(ctx context.Context, filePath string) (string, int64, error) {
 	migration, err := m.readFile(filePath)
 	if err != nil {
-		return err
+		return "", 0, err
+	}
+
+	directives, err := ParseDirectives(migration)
+	if err != nil {
+		return "", 0, err
 	}
 
-	migrationStr := string(migration)
-	if len(m.Cnf.Values) > 0 {
-		migrationStr = os.Expand(string(migration), mapToFunc(m.Cnf.Values))
+	execCtx := ctx
+
+	var timeoutQuery string
+	if timeout := m.statementTimeout(ctx, directives); timeout > 0 {
+		if timeoutQuery = m.dialectWithDefaults().StatementTimeout(timeout); timeoutQuery == "" {
+			var cancel context.CancelFunc
+			execCtx, cancel = context.WithTimeout(ctx, timeout)
+
+			defer cancel()
+		}
 	}
 
-	_, err = m.Tx.ExecContext(ctx, migrationStr)
+	if timeoutQuery != "" {
+		if _, err := m.Tx.ExecContext(ctx, timeoutQuery); err != nil {
+			return "", 0, fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+	}
 
-	return err
+	rows, err := m.execMigration(execCtx, m.Tx, filePath, migration)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if timeoutQuery != "" {
+		// Next migrations get their own timeout.
+		if _, err := m.Tx.ExecContext(ctx, m.dialectWithDefaults().StatementTimeout(0)); err != nil {
+			return "", 0, fmt.Errorf("failed to reset statement timeout: %w", err)
+		}
+	}
+
+	fileChecksum, err := m.contentChecksum(filePath, migration)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fileChecksum, rows, nil
+}
+
+// execer runs statements, like Transaction and DB of non-transactional migrations.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execMigration runs the migration after variables are replaced and returns affected rows.
+//
+// With Config.SplitStatements statements run one by one and affected rows are summed.
+func (m *Migrator) execMigration(ctx context.Context, db execer, filePath string, migration []byte) (int64, error) {
+	source, expanded, err := m.prepareMigration(filePath, migration)
+	if err != nil {
+		return 0, err
+	}
+
+	statements := []Statement{{Text: expanded.text}}
+	if m.Cnf.SplitStatements {
+		statements = m.dialectWithDefaults().SplitStatements(expanded.text)
+	}
+
+	var rows int64
+	for i, statement := range statements {
+		start := time.Now()
+
+		res, err := db.ExecContext(ctx, statement.Text)
+		if err != nil {
+			return rows, &execError{
+				statement: statement.Text,
+				source:    source,
+				expansion: &expanded,
+				offset:    statement.Offset,
+				err:       err,
+			}
+		}
+
+		rows += rowsAffected(res)
+
+		if m.Cnf.SplitStatements {
+			m.Logger.Info("run statement", "migration_path", filePath, "statement", i+1,
+				"duration", time.Since(start).String(), "rows_affected", rowsAffected(res))
+		}
+	}
+
+	return rows, nil
+}
+
+// rowsAffected returns affected rows of the result, 0 if the driver does not report it.
+func rowsAffected(res sql.Result) int64 {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+
+	return rows
+}
+
+// statementTimeout returns timeout of the migration file, limited by the remaining Config.MaxDuration.
+// Zero means no timeout.
+func (m *Migrator) statementTimeout(ctx context.Context, directives Directives) time.Duration {
+	timeout := m.Cnf.StatementTimeout
+	if directives.StatementTimeout > 0 {
+		timeout = directives.StatementTimeout
+	}
+
+	if m.Cnf.MaxDuration <= 0 {
+		return timeout
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+
+	if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+		// Already exceeded deadline fails on the context, not on a zero timeout.
+		timeout = max(remaining, time.Millisecond)
+	}
+
+	return timeout
+}
+
+// maxDurationExceeded reports whether Config.MaxDuration of the run is over.
+// Deadline of the caller's context is not Config.MaxDuration.
+func maxDurationExceeded(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrMaxDuration)
+}
+
+// prepareMigration renders template files and replaces variables of Config.Values in other files.
+//
+// It also returns the source which positions of errors are mapped to, the rendered SQL for templates.
+func (m *Migrator) prepareMigration(filePath string, migration []byte) (string, expansion, error) {
+	if isTemplate(filePath) {
+		rendered, err := m.render(filePath, migration)
+		if err != nil {
+			return "", expansion{}, fmt.Errorf("failed to render template: %w", err)
+		}
+
+		return rendered, expansion{text: rendered}, nil
+	}
+
+	expanded, err := expand(string(migration), m.dialectWithDefaults().syntax(), m.Cnf.Values)
+
+	return string(migration), expanded, err
 }
 
 // InsertNewVersion adds new migration version to migration table.
 func (m *Migrator) InsertNewVersion(ctx context.Context, directoryPath string, version int) error {
-	_, err := m.Tx.ExecContext(ctx, "INSERT INTO "+m.MigrationTable()+"(path, version) VALUES ($1, $2)", directoryPath, version)
+	return m.InsertRecord(ctx, &MigrationRecord{Path: directoryPath, Version: version})
+}
+
+// InsertRecord adds the applied migration to migration table and to Records of the result.
+//
+// AppliedBy, Hostname and AppVersion of the record are filled before it is added,
+// Name is stored in the file column and empty values are stored as NULL.
+func (m *Migrator) InsertRecord(ctx context.Context, record *MigrationRecord) error {
+	if err := m.insertRecord(ctx, record); err != nil {
+		return err
+	}
+
+	m.records = append(m.records, *record)
+
+	return nil
+}
+
+// insertRecord adds the record to migration table only, like versions of a baseline which are not run.
+func (m *Migrator) insertRecord(ctx context.Context, record *MigrationRecord) error {
+	appliedBy, err := m.currentUser(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get database user: %w", err)
+	}
+
+	record.AppliedBy = appliedBy
+	record.Hostname, _ = os.Hostname()
+	record.AppVersion = m.Cnf.AppVersion
+
+	d := m.Dialect()
+	_, err = m.Tx.ExecContext(ctx, "INSERT INTO "+m.MigrationTable()+
+		"(path, version, checksum, file, duration_ms, applied_by, hostname, app_version) VALUES ("+
+		d.Placeholder(1)+", "+d.Placeholder(2)+", "+d.Placeholder(3)+", "+d.Placeholder(4)+", "+
+		d.Placeholder(5)+", "+d.Placeholder(6)+", "+d.Placeholder(7)+", "+d.Placeholder(8)+")",
+		record.Path, record.Version, nullString(record.Checksum), nullString(record.Name),
+		record.Duration.Milliseconds(), nullString(record.AppliedBy), nullString(record.Hostname), nullString(record.AppVersion))
+
+	return err
+}
+
+// currentUser returns the database user, it is queried once for the migrator.
+func (m *Migrator) currentUser(ctx context.Context) (string, error) {
+	if m.appliedBy != nil {
+		return *m.appliedBy, nil
+	}
+
+	var user string
+	if query := m.dialectWithDefaults().CurrentUser(); query != "" {
+		if err := m.Tx.QueryRowContext(ctx, query).Scan(&user); err != nil {
+			return "", err
+		}
+	}
+
+	m.appliedBy = &user
+
+	return user, nil
+}
+
+// nullString returns NULL for empty strings.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// DeleteVersion removes migration version from migration table.
+func (m *Migrator) DeleteVersion(ctx context.Context, directoryPath string, version int) error {
+	d := m.Dialect()
+	_, err := m.Tx.ExecContext(ctx, "DELETE FROM "+m.MigrationTable()+" WHERE path = "+d.Placeholder(1)+" AND version = "+d.Placeholder(2), directoryPath, version)
 
 	return err
 }
 
 // CreateMigrationTable creates the migration table if not present.
 func (m *Migrator) CreateMigrationTable(ctx context.Context) error {
-	_, err := m.Tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+m.MigrationTable()+` (
-		path        VARCHAR(1000) NOT NULL DEFAULT '/',
-		version     INT,
-		migrated_on	TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		PRIMARY KEY (path, version)
-	)`)
+	_, err := m.Tx.ExecContext(ctx, m.Dialect().CreateMigrationTable(m.MigrationTable()))
 
 	return err
 }
 
+// ensureColumn adds column to the migration table if it is missing and reports whether it is added.
+func (m *Migrator) ensureColumn(ctx context.Context, column, definition string) (bool, error) {
+	exists, err := m.columnExists(ctx, column)
+	if err != nil || exists {
+		return false, err
+	}
+
+	m.Logger.Info("adding column to migration table", "table", m.MigrationTable(), "column", column)
+
+	if _, err := m.Tx.ExecContext(ctx, m.dialectWithDefaults().AddColumn(m.MigrationTable(), column, definition)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// columnExists reports whether the migration table has the column.
+func (m *Migrator) columnExists(ctx context.Context, column string) (bool, error) {
+	var exists bool
+	err := m.Tx.QueryRowContext(ctx, m.dialectWithDefaults().ColumnExists(m.Cnf.Schema, m.Cnf.MigrationTable, column)).Scan(&exists)
+
+	return exists, err
+}
+
 // GetLastVersion returns the latest migration version.
 func (m *Migrator) GetLastVersion(ctx context.Context, directoryPath string) (int, error) {
 	var lastVersion sql.NullInt64
-	err := m.Tx.QueryRowContext(ctx, "SELECT MAX(version) FROM "+m.MigrationTable()+" WHERE path = $1", directoryPath).Scan(&lastVersion)
+	err := m.Tx.QueryRowContext(ctx, "SELECT MAX(version) FROM "+m.MigrationTable()+" WHERE path = "+m.Dialect().Placeholder(1), directoryPath).Scan(&lastVersion)
 
 	return int(lastVersion.Int64), err
 }
 
+// GetAppliedVersions returns all applied versions of the directory in ascending order.
+func (m *Migrator) GetAppliedVersions(ctx context.Context, directoryPath string) ([]int, error) {
+	rows, err := m.Tx.QueryContext(ctx, "SELECT version FROM "+m.MigrationTable()+" WHERE path = "+m.Dialect().Placeholder(1)+" ORDER BY version", directoryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, version)
+	}
+
+	return versions, rows.Err()
+}
+
 // AcquireLock acquires lock on migration table so that no other parallel migration is allowed.
+// Lock is taken with Config.Locker and released when the transaction ends.
 func (m *Migrator) AcquireLock(ctx context.Context) error {
-	// Lock the migrations table so that other parallel migrations are blocked until current one is finished
-	_, err := m.Tx.ExecContext(ctx, "lock table "+m.MigrationTable()+" in ACCESS EXCLUSIVE mode;")
-	if err != nil {
-		return err
+	locker := m.Cnf.locker()
+
+	if m.Cnf.LockTimeout > 0 {
+		if err := m.setLockTimeout(ctx, m.Cnf.LockTimeout); err != nil {
+			return err
+		}
+	}
+
+	// Other parallel migrations are blocked until current one is finished
+	if err := locker.Lock(ctx, m.Tx, m.MigrationTable()); err != nil {
+		if m.Cnf.LockTimeout > 0 {
+			if lockErr := newLockTimeoutError(ctx, m.Dialect(), locker, m.DB, m.MigrationTable(), m.Cnf.LockTimeout, err); lockErr != nil {
+				m.Logger.Error("migration lock timeout", "table", lockErr.Table, "timeout", lockErr.Timeout.String(), "holders", lockErr.Holders)
+
+				return lockErr
+			}
+		}
+
+		return fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	if m.Cnf.LockTimeout > 0 {
+		// Migrations themselves wait for locks without the limit.
+		return m.setLockTimeout(ctx, 0)
 	}
 
 	return nil
 }
 
-func (m *Migrator) MigrationTable() string {
-	if m.Cnf.Schema == "" {
-		return m.Cnf.MigrationTable
+// setLockTimeout limits waiting for locks in the transaction, zero restores the default.
+func (m *Migrator) setLockTimeout(ctx context.Context, timeout time.Duration) error {
+	query := m.dialectWithDefaults().LockTimeout(timeout)
+	if query == "" {
+		return nil
 	}
 
-	return m.Cnf.Schema + "." + m.Cnf.MigrationTable
+	if _, err := m.Tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to set lock timeout: %w", err)
+	}
+
+	return nil
+}
+
+// Dialect returns configured dialect, PostgreSQLDialect if not set.
+func (m *Migrator) Dialect() Dialect {
+	return m.Cnf.dialect()
+}
+
+// dialectWithDefaults returns configured dialect with defaults of the optional interfaces it does not implement.
+func (m *Migrator) dialectWithDefaults() dialectDefaults {
+	return dialectDefaults{m.Dialect()}
+}
+
+func (m *Migrator) MigrationTable() string {
+	return qualifiedName(m.Cnf.Schema, m.Cnf.MigrationTable)
+}
+
+// MigrationTableExists reports whether the migration table is already created.
+func (m *Migrator) MigrationTableExists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := m.Tx.QueryRowContext(ctx, m.dialectWithDefaults().TableExists(m.Cnf.Schema, m.Cnf.MigrationTable)).Scan(&exists)
+
+	return exists, err
 }
 
 // VersionFromFile returns version of migration file.
@@ -374,10 +1092,14 @@ func VersionFromFile(fileName string) int {
 	return version
 }
 
-func mapToFunc(values map[string]string) func(string) string {
-	return func(key string) string {
-		return values[key]
-	}
+// relativeDir returns directory path relative to the migrations directory, like `/test`.
+func (m *Migrator) relativeDir(migrationDir string) string {
+	return cleanPath(strings.TrimPrefix(path.Clean(migrationDir), path.Clean(m.Cnf.MigrationsDir)))
+}
+
+// cleanPath returns directory path in the form used in migration table, like `/` or `/test`.
+func cleanPath(directoryPath string) string {
+	return path.Clean("/" + directoryPath)
 }
 
 func getPath(filePath string) string {
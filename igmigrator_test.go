@@ -2,7 +2,11 @@ package igmigrator
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"os"
+	"regexp"
 	"testing"
 	"time"
 
@@ -22,9 +26,43 @@ type tableStruct struct {
 }
 
 type migrationData struct {
-	Path       string    `db:"path"`
-	Version    int       `db:"version"`
-	MigratedOn time.Time `db:"migrated_on"`
+	Path       string         `db:"path"`
+	Version    int            `db:"version"`
+	MigratedOn time.Time      `db:"migrated_on"`
+	Checksum   sql.NullString `db:"checksum"`
+	File       sql.NullString `db:"file"`
+	DurationMS sql.NullInt64  `db:"duration_ms"`
+	AppliedBy  sql.NullString `db:"applied_by"`
+	Hostname   sql.NullString `db:"hostname"`
+	AppVersion sql.NullString `db:"app_version"`
+}
+
+// recordArgs returns arguments of an inserted migration record, details of the run are not compared.
+func recordArgs(path string, version int, checksum driver.Value) []driver.Value {
+	return []driver.Value{path, version, checksum, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()}
+}
+
+// expectCurrentUser expects the query of the database user, done once before the first inserted record.
+func expectCurrentUser(mck sqlmock.Sqlmock) {
+	mck.ExpectQuery("SELECT current_user").WillReturnRows(sqlmock.NewRows([]string{"current_user"}).AddRow("migrator"))
+}
+
+// expectPrepareDB expects creating the migration and metadata tables, locking the migration table
+// and reading its layout version, which is up to date.
+func expectPrepareDB(mck sqlmock.Sqlmock, table string) {
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS " + regexp.QuoteMeta(table)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS " + regexp.QuoteMeta(table+"_metadata")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("lock table " + regexp.QuoteMeta(table) + " in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM " + regexp.QuoteMeta(table+"_metadata")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+}
+
+// expectMigrationTable expects checking that the migration table exists with the latest layout, done before reads without upgrade.
+func expectMigrationTable(mck sqlmock.Sqlmock, table string) {
+	mck.ExpectQuery("SELECT to_regclass\\('" + regexp.QuoteMeta(table) + "'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mck.ExpectQuery("SELECT to_regclass\\('" + regexp.QuoteMeta(table+"_metadata") + "'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM " + regexp.QuoteMeta(table+"_metadata")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
 }
 
 func TestMain(m *testing.M) {
@@ -96,9 +134,17 @@ func TestMigrations(t *testing.T) {
 					{"accounts", "user_id"},
 					{"dummy", "dummy_col"},
 					{"latest", "col1"},
+					{"migration", "app_version"},
+					{"migration", "applied_by"},
+					{"migration", "checksum"},
+					{"migration", "duration_ms"},
+					{"migration", "file"},
+					{"migration", "hostname"},
 					{"migration", "migrated_on"},
 					{"migration", "path"},
 					{"migration", "version"},
+					{"migration_metadata", "upgraded_on"},
+					{"migration_metadata", "version"},
 				})
 
 				// Check if all migrations were written to MigrationTable
@@ -122,9 +168,17 @@ func TestMigrations(t *testing.T) {
 				assertTables(t, db, conf.Schema, []tableStruct{
 					{"another", "id"},
 					{"another", "purchased_at"},
+					{"migration", "app_version"},
+					{"migration", "applied_by"},
+					{"migration", "checksum"},
+					{"migration", "duration_ms"},
+					{"migration", "file"},
+					{"migration", "hostname"},
 					{"migration", "migrated_on"},
 					{"migration", "path"},
 					{"migration", "version"},
+					{"migration_metadata", "upgraded_on"},
+					{"migration_metadata", "version"},
 					{"test", "created_at"},
 					{"test", "description"},
 					{"test", "id"},
@@ -148,9 +202,17 @@ func TestMigrations(t *testing.T) {
 			},
 			ValidateFunc: func(t *testing.T, db *sqlx.DB, conf *Config) {
 				assertTables(t, db, conf.Schema, []tableStruct{
+					{"migration", "app_version"},
+					{"migration", "applied_by"},
+					{"migration", "checksum"},
+					{"migration", "duration_ms"},
+					{"migration", "file"},
+					{"migration", "hostname"},
 					{"migration", "migrated_on"},
 					{"migration", "path"},
 					{"migration", "version"},
+					{"migration_metadata", "upgraded_on"},
+					{"migration_metadata", "version"},
 					{"test_table_1", "id"},
 					{"test_table_1", "name"},
 					{"test_table_2", "age"},
@@ -191,9 +253,17 @@ func TestMigrations(t *testing.T) {
 				})
 				assertTables(t, db, conf.Schema, []tableStruct{
 					{"dummy", "dummy_col"},
+					{"migration", "app_version"},
+					{"migration", "applied_by"},
+					{"migration", "checksum"},
+					{"migration", "duration_ms"},
+					{"migration", "file"},
+					{"migration", "hostname"},
 					{"migration", "migrated_on"},
 					{"migration", "path"},
 					{"migration", "version"},
+					{"migration_metadata", "upgraded_on"},
+					{"migration_metadata", "version"},
 				})
 			},
 		},
@@ -206,7 +276,7 @@ func TestMigrations(t *testing.T) {
 		{
 			Path: "invalid_middle_migration",
 			ErrorFunc: func(t *testing.T, err error) {
-				assert.Equal(t, `failed migration on testdata/invalid_middle_migration/2_install_pos.sql version 2: ERROR: syntax error at or near "and" (SQLSTATE 42601)`, err.Error())
+				assert.Equal(t, `failed migration on testdata/invalid_middle_migration/2_install_pos.sql:2:20 version 2: ERROR: syntax error at or near "and" (SQLSTATE 42601)`, err.Error())
 			},
 			ValidateVersFunc: func(t *testing.T, prev int, current int) {
 				assert.Equal(t, 0, prev)
@@ -354,15 +424,21 @@ func TestMigrate_Locking(t *testing.T) {
 				mck.ExpectBegin()
 
 				// Create migration table if not exists.
-				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration \\( path VARCHAR\\(1000\\) NOT NULL DEFAULT '/', version INT, migrated_on TIMESTAMPTZ NOT NULL DEFAULT NOW\\(\\), PRIMARY KEY \\(path, version\\) \\)").WillReturnResult(sqlmock.NewResult(0, 0))
-				// Get actual version.
-				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration \\( path VARCHAR\\(1000\\) NOT NULL DEFAULT '/', version INT, migrated_on TIMESTAMPTZ NOT NULL DEFAULT NOW\\(\\), checksum VARCHAR\\(64\\), file VARCHAR\\(255\\), duration_ms BIGINT, applied_by VARCHAR\\(255\\), hostname VARCHAR\\(255\\), app_version VARCHAR\\(255\\), PRIMARY KEY \\(path, version\\) \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
 				// Lock migration table.
 				mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+				// Validate migration files against applied versions.
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+				mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+				// Get actual version.
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(0)))
 				// Apply db schema change.
 				mck.ExpectExec("CREATE TABLE accounts \\( user_id serial PRIMARY KEY, last_login TIMESTAMP \\)").WillReturnResult(sqlmock.NewResult(1, 1))
 				// Update version.
-				mck.ExpectExec("INSERT INTO migration\\(path, version\\) VALUES \\(\\$1, \\$2\\)").WithArgs("/", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectCurrentUser(mck)
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
 
 				mck.ExpectCommit()
 			},
@@ -370,14 +446,21 @@ func TestMigrate_Locking(t *testing.T) {
 			actual: 1,
 		},
 		{
-			name: "no_update_no_lock",
+			name: "no_update",
 			init: func(mck sqlmock.Sqlmock) {
 				mck.MatchExpectationsInOrder(true)
 
 				mck.ExpectBegin()
 
 				// Create migration table if not exists.
-				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration \\( path VARCHAR\\(1000\\) NOT NULL DEFAULT '/', version INT, migrated_on TIMESTAMPTZ NOT NULL DEFAULT NOW\\(\\), PRIMARY KEY \\(path, version\\) \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration \\( path VARCHAR\\(1000\\) NOT NULL DEFAULT '/', version INT, migrated_on TIMESTAMPTZ NOT NULL DEFAULT NOW\\(\\), checksum VARCHAR\\(64\\), file VARCHAR\\(255\\), duration_ms BIGINT, applied_by VARCHAR\\(255\\), hostname VARCHAR\\(255\\), app_version VARCHAR\\(255\\), PRIMARY KEY \\(path, version\\) \\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+				// Lock migration table.
+				mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+				// Validate migration files against applied versions.
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+				mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
 
 				// Get actual version.
 				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
@@ -415,6 +498,44 @@ func TestMigrate_Locking(t *testing.T) {
 	}
 }
 
+func TestMigrate_Records(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").
+		WithArgs("/", 1, sqlmock.AnyArg(), "1_install_table.sql", sqlmock.AnyArg(), "migrator", hostname, "v1.2.0").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	result, err := Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("locking"), AppVersion: "v1.2.0"})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	require.Len(t, result.Records, 1)
+	record := result.Records[0]
+	assert.Equal(t, "/", record.Path)
+	assert.Equal(t, 1, record.Version)
+	assert.Equal(t, "/1_install_table.sql", record.File)
+	assert.Equal(t, "1_install_table.sql", record.Name)
+	assert.NotEmpty(t, record.Checksum)
+	assert.Equal(t, "migrator", record.AppliedBy)
+	assert.Equal(t, hostname, record.Hostname)
+	assert.Equal(t, "v1.2.0", record.AppVersion)
+}
+
 func TestMigrate_AddPreFolder(t *testing.T) {
 	m := Migrator{
 		Cnf: &Config{
@@ -0,0 +1,352 @@
+package igmigrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// Locker locks the migration table so that no other parallel migration is allowed.
+//
+// Lock is called before any version is read and it should block until the lock is acquired.
+// Table is the migration table name, qualified with the schema if it is set.
+type Locker interface {
+	// Lock acquires the lock till the end of the transaction.
+	Lock(ctx context.Context, tx Transaction, table string) error
+}
+
+// SessionLocker is a Locker which can also hold the lock on a single connection across transactions.
+//
+// Migrate holds the session lock for the whole run, including non-transactional migration files,
+// when the database can pin a connection with `Conn(ctx)` like `*sql.DB`.
+type SessionLocker interface {
+	Locker
+	// LockSession acquires the lock till UnlockSession is called on the same connection.
+	LockSession(ctx context.Context, conn Transaction, table string) error
+	// UnlockSession releases the lock acquired by LockSession.
+	UnlockSession(ctx context.Context, conn Transaction, table string) error
+}
+
+// LockHolderFinder is implemented by lockers which can report sessions holding their lock.
+//
+// It is called after the lock is timed out, with a database connection outside of the locking transaction.
+type LockHolderFinder interface {
+	LockHolders(ctx context.Context, db Transaction, table string) ([]LockHolder, error)
+}
+
+// LockHolder is a database session holding the migration lock.
+type LockHolder struct {
+	PID             int
+	ApplicationName string
+	ClientAddr      string
+}
+
+// LockTimeoutError is returned when the migration lock is not acquired in Config.LockTimeout.
+type LockTimeoutError struct {
+	Table   string
+	Timeout time.Duration
+	// Holders are sessions holding the lock, empty if they cannot be found.
+	Holders []LockHolder
+	Err     error
+}
+
+func (e *LockTimeoutError) Error() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "lock of %s not acquired in %s", e.Table, e.Timeout)
+
+	for i, holder := range e.Holders {
+		if i == 0 {
+			sb.WriteString(", held by")
+		} else {
+			sb.WriteString(",")
+		}
+
+		fmt.Fprintf(&sb, " pid %d application %q client %q", holder.PID, holder.ApplicationName, holder.ClientAddr)
+	}
+
+	fmt.Fprintf(&sb, ": %v", e.Err)
+
+	return sb.String()
+}
+
+func (e *LockTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches ErrLockTimeout.
+func (e *LockTimeoutError) Is(target error) bool {
+	return target == ErrLockTimeout
+}
+
+// newLockTimeoutError returns LockTimeoutError if err is a lock timeout, otherwise nil.
+// Holders are added if the locker can find them and db can run queries.
+func newLockTimeoutError(ctx context.Context, dialect Dialect, locker Locker, db any, table string, timeout time.Duration, err error) *LockTimeoutError {
+	if !isLockTimeout(dialect, err) {
+		return nil
+	}
+
+	lockErr := &LockTimeoutError{Table: table, Timeout: timeout, Err: err}
+
+	finder, ok := locker.(LockHolderFinder)
+	if !ok {
+		return lockErr
+	}
+
+	conn, ok := db.(Transaction)
+	if !ok {
+		return lockErr
+	}
+
+	// Holders are only a hint, error of the lock is returned anyway.
+	lockErr.Holders, _ = finder.LockHolders(context.WithoutCancel(ctx), conn, table)
+
+	return lockErr
+}
+
+// lockWaitError is returned by lockSession when the wait for the lock is stopped by Config.LockTimeout.
+type lockWaitError struct {
+	err error
+}
+
+func (e *lockWaitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *lockWaitError) Unwrap() error {
+	return e.err
+}
+
+// isLockTimeout reports whether err is returned because of waiting too long for a lock.
+//
+// Deadline of the context is only a lock timeout if it is set by lockSession, not by the caller or Config.MaxDuration.
+func isLockTimeout(dialect Dialect, err error) bool {
+	var waitErr *lockWaitError
+	if errors.As(err, &waitErr) {
+		return true
+	}
+
+	return dialectDefaults{Dialect: dialect}.IsLockTimeout(err)
+}
+
+// scanLockHolders reads rows of pid, application name and client address.
+func scanLockHolders(ctx context.Context, db Transaction, query string, args ...any) ([]LockHolder, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holders []LockHolder
+	for rows.Next() {
+		var holder LockHolder
+		if err := rows.Scan(&holder.PID, &holder.ApplicationName, &holder.ClientAddr); err != nil {
+			return nil, err
+		}
+
+		holders = append(holders, holder)
+	}
+
+	return holders, rows.Err()
+}
+
+// TableLocker locks the migration table with the LockTable statement of the dialect.
+//
+// It is the default locker of dialects without LockerProvider and of the built-in dialects except MySQLDialect.
+type TableLocker struct {
+	Dialect Dialect
+}
+
+func (l TableLocker) Lock(ctx context.Context, tx Transaction, table string) error {
+	dialect := l.Dialect
+	if dialect == nil {
+		dialect = PostgreSQLDialect{}
+	}
+
+	query := dialect.LockTable(table)
+	if query == "" {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, query)
+
+	return err
+}
+
+// LockHolders returns sessions holding a lock on the migration table, only supported in PostgreSQL.
+func (l TableLocker) LockHolders(ctx context.Context, db Transaction, table string) ([]LockHolder, error) {
+	if _, ok := l.Dialect.(PostgreSQLDialect); !ok && l.Dialect != nil {
+		return nil, nil
+	}
+
+	return scanLockHolders(ctx, db, `SELECT a.pid, COALESCE(a.application_name, ''), COALESCE(host(a.client_addr), '')
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'relation' AND l.relation = to_regclass($1) AND l.granted AND l.pid <> pg_backend_pid()
+		ORDER BY a.pid`, table)
+}
+
+// takesLock reports whether locker locks anything, TableLocker does not if the dialect has no LockTable statement.
+func takesLock(locker Locker) bool {
+	tableLocker, ok := locker.(TableLocker)
+	if !ok || tableLocker.Dialect == nil {
+		return true
+	}
+
+	return tableLocker.Dialect.LockTable("migration") != ""
+}
+
+// AdvisoryLocker locks with PostgreSQL advisory locks instead of locking the migration table,
+// so readers of the migration table are not blocked.
+//
+// Lock key is derived from the qualified migration table name.
+type AdvisoryLocker struct{}
+
+func (AdvisoryLocker) Lock(ctx context.Context, tx Transaction, table string) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", AdvisoryLockKey(table))
+
+	return err
+}
+
+func (AdvisoryLocker) LockSession(ctx context.Context, conn Transaction, table string) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", AdvisoryLockKey(table))
+
+	return err
+}
+
+func (AdvisoryLocker) UnlockSession(ctx context.Context, conn Transaction, table string) error {
+	var unlocked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", AdvisoryLockKey(table)).Scan(&unlocked); err != nil {
+		return err
+	}
+
+	if !unlocked {
+		return fmt.Errorf("advisory lock of %s was not held", table)
+	}
+
+	return nil
+}
+
+func (AdvisoryLocker) LockHolders(ctx context.Context, db Transaction, table string) ([]LockHolder, error) {
+	// Advisory lock with a bigint key is stored as high and low 32 bits in classid and objid.
+	return scanLockHolders(ctx, db, `SELECT a.pid, COALESCE(a.application_name, ''), COALESCE(host(a.client_addr), '')
+		FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+		WHERE l.locktype = 'advisory' AND l.objsubid = 1 AND ((l.classid::bigint << 32) | l.objid::bigint) = $1
+		AND l.database = (SELECT oid FROM pg_database WHERE datname = current_database())
+		AND l.granted AND l.pid <> pg_backend_pid()
+		ORDER BY a.pid`, AdvisoryLockKey(table))
+}
+
+// MySQLLocker locks with MySQL named locks of `GET_LOCK` on the connection of Migrate,
+// so the lock is kept when DDL statements commit the transaction implicitly.
+//
+// Without a pinned connection, like in MigrateInTx, it locks the migration table with `SELECT ... FOR UPDATE`,
+// which is released by the first DDL statement.
+type MySQLLocker struct{}
+
+func (MySQLLocker) Lock(ctx context.Context, tx Transaction, table string) error {
+	return TableLocker{Dialect: MySQLDialect{}}.Lock(ctx, tx, table)
+}
+
+func (MySQLLocker) LockSession(ctx context.Context, conn Transaction, table string) error {
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, -1)", mysqlLockName(table)).Scan(&locked); err != nil {
+		return err
+	}
+
+	if locked.Int64 != 1 {
+		return fmt.Errorf("named lock of %s not acquired", table)
+	}
+
+	return nil
+}
+
+func (MySQLLocker) UnlockSession(ctx context.Context, conn Transaction, table string) error {
+	var unlocked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", mysqlLockName(table)).Scan(&unlocked); err != nil {
+		return err
+	}
+
+	if unlocked.Int64 != 1 {
+		return fmt.Errorf("named lock of %s was not held", table)
+	}
+
+	return nil
+}
+
+// mysqlLockName returns the named lock of the migration table, names are limited to 64 characters in MySQL.
+func mysqlLockName(table string) string {
+	return fmt.Sprintf("igmigrator:%x", uint64(AdvisoryLockKey(table))) //nolint:gosec // only formatted
+}
+
+// AdvisoryLockKey returns the advisory lock key of the migration table.
+func AdvisoryLockKey(table string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("igmigrator:" + table))
+
+	return int64(h.Sum64()) //nolint:gosec // key only needs to be stable
+}
+
+// withSessionLock runs fn with a pinned connection holding the session lock, if Config.Locker supports it.
+// Otherwise fn is called with db and locking is left to the transactions.
+func withSessionLock(ctx context.Context, db DB, cnf *Config, fn func(db DB, session bool) error) (err error) {
+	cnf.Sanitize()
+
+	locker, ok := cnf.locker().(SessionLocker)
+	if !ok {
+		return fn(db, false)
+	}
+
+	pool, ok := db.(interface {
+		Conn(ctx context.Context) (*sql.Conn, error)
+	})
+	if !ok {
+		return fn(db, false)
+	}
+
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	table := qualifiedName(cnf.Schema, cnf.MigrationTable)
+
+	if err := lockSession(ctx, locker, conn, table, cnf.LockTimeout); err != nil {
+		if lockErr := newLockTimeoutError(ctx, cnf.dialect(), locker, db, table, cnf.LockTimeout, err); lockErr != nil {
+			return lockErr
+		}
+
+		return fmt.Errorf("failed to acquire session lock: %w", err)
+	}
+
+	defer func() {
+		// Connection goes back to the pool, release the lock even if the context is canceled.
+		if unlockErr := locker.UnlockSession(context.WithoutCancel(ctx), conn, table); unlockErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to release session lock: %w", unlockErr))
+		}
+	}()
+
+	return fn(conn, true)
+}
+
+// lockSession acquires the session lock, waiting at most timeout if it is positive.
+func lockSession(ctx context.Context, locker SessionLocker, conn Transaction, table string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return locker.LockSession(ctx, conn, table)
+	}
+
+	lockCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := locker.LockSession(lockCtx, conn, table)
+	if err != nil && ctx.Err() == nil && lockCtx.Err() != nil {
+		// Driver errors of canceled queries do not always wrap the context error.
+		return &lockWaitError{err: fmt.Errorf("%w: %w", context.DeadlineExceeded, err)}
+	}
+
+	return err
+}
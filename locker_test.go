@@ -0,0 +1,229 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestAdvisoryLockKey(t *testing.T) {
+	assert.Equal(t, AdvisoryLockKey("migration"), AdvisoryLockKey("migration"))
+	assert.NotEqual(t, AdvisoryLockKey("migration"), AdvisoryLockKey("test.migration"))
+}
+
+func TestMigrate_AdvisoryLocker(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	key := AdvisoryLockKey("test.migration")
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectExec("SELECT pg_advisory_lock\\(\\$1\\)").WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectBegin()
+	mck.ExpectExec("set local search_path = test").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS test.migration").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS test.migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("SELECT pg_advisory_xact_lock\\(\\$1\\)").WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM test.migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+	mck.ExpectQuery("SELECT version FROM test.migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM test.migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM test.migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO test.migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+	mck.ExpectQuery("SELECT pg_advisory_unlock\\(\\$1\\)").WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"unlocked"}).AddRow(true))
+
+	result, err := Migrate(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		Schema:        "test",
+		Locker:        AdvisoryLocker{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 1}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrate_MySQLLocker(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	// MySQLLocker is the default locker of MySQLDialect.
+	name := mysqlLockName("test.migration")
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectQuery("SELECT GET_LOCK\\(\\?, -1\\)").WithArgs(name).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	mck.ExpectBegin()
+	mck.ExpectExec("USE test").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS test.migration").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS test.migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("SELECT version FROM test.migration FOR UPDATE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM test.migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+	mck.ExpectQuery("SELECT version FROM test.migration WHERE path = \\? ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM test.migration WHERE path = \\? AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM test.migration WHERE path = \\?").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT CURRENT_USER\\(\\)").WillReturnRows(sqlmock.NewRows([]string{"user"}).AddRow("migrator@localhost"))
+	mck.ExpectExec("INSERT INTO test.migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+	mck.ExpectQuery("SELECT RELEASE_LOCK\\(\\?\\)").WithArgs(name).WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(1))
+
+	result, err := Migrate(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		Schema:        "test",
+		Dialect:       MySQLDialect{},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 1}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrate_LockTimeout(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("SET LOCAL lock_timeout = '1500ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnError(&pgconn.PgError{Severity: "ERROR", Code: "55P03", Message: "canceling statement due to lock timeout"})
+	mck.ExpectQuery("SELECT a.pid, .* FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid WHERE l.locktype = 'relation'").WithArgs("migration").
+		WillReturnRows(sqlmock.NewRows([]string{"pid", "application_name", "client_addr"}).AddRow(42, "billing", "10.0.0.7"))
+	mck.ExpectRollback()
+
+	_, err = Migrate(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		LockTimeout:   1500 * time.Millisecond,
+	})
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	require.ErrorIs(t, err, ErrLockTimeout)
+
+	var lockErr *LockTimeoutError
+	require.ErrorAs(t, err, &lockErr)
+	assert.Equal(t, []LockHolder{{PID: 42, ApplicationName: "billing", ClientAddr: "10.0.0.7"}}, lockErr.Holders)
+	assert.EqualError(t, err, `lock of migration not acquired in 1.5s, held by pid 42 application "billing" client "10.0.0.7": ERROR: canceling statement due to lock timeout (SQLSTATE 55P03)`)
+}
+
+func TestAcquireLock_LockTimeout(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx:     db,
+		Cnf:    &Config{MigrationTable: "migration", LockTimeout: time.Second},
+		Logger: logz.AdapterNoop{},
+	}
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectExec("SET LOCAL lock_timeout = '1000ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("SET LOCAL lock_timeout = DEFAULT").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, m.AcquireLock(context.Background()))
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+type sqlServerError struct {
+	number int32
+}
+
+func (e sqlServerError) Error() string         { return "mssql: Lock request time out period exceeded." }
+func (e sqlServerError) SQLErrorNumber() int32 { return e.number }
+
+// mysqlError has the Number field of *mysql.MySQLError of go-sql-driver/mysql, it is matched only if it is added to mysqlErrorTypes.
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string {
+	return fmt.Sprintf("Error %d: %s", e.Number, e.Message)
+}
+
+func TestIsLockTimeout(t *testing.T) {
+	mysqlType := reflect.TypeOf(mysqlError{})
+	mysqlName := mysqlType.PkgPath() + "." + mysqlType.Name()
+
+	mysqlErrorTypes[mysqlName] = struct{}{}
+	t.Cleanup(func() { delete(mysqlErrorTypes, mysqlName) })
+
+	tests := []struct {
+		name    string
+		dialect Dialect
+		err     error
+		want    bool
+	}{
+		{
+			name: "postgres lock_not_available",
+			err:  fmt.Errorf("lock: %w", &pgconn.PgError{Code: "55P03"}),
+			want: true,
+		},
+		{
+			name: "postgres other error",
+			err:  &pgconn.PgError{Code: "42P01"},
+		},
+		{
+			name:    "mysql lock wait timeout",
+			dialect: MySQLDialect{},
+			err:     fmt.Errorf("lock: %w", &mysqlError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"}),
+			want:    true,
+		},
+		{
+			name:    "mysql other error",
+			dialect: MySQLDialect{},
+			err:     &mysqlError{Number: 1146, Message: "Table 'test.migration' doesn't exist"},
+		},
+		{
+			name:    "mysql message of lock wait timeout",
+			dialect: MySQLDialect{},
+			err:     errors.New("Error 1205 (HY000): Lock wait timeout exceeded; try restarting transaction"),
+		},
+		{
+			name:    "sqlserver lock request timeout",
+			dialect: SQLServerDialect{},
+			err:     sqlServerError{number: 1222},
+			want:    true,
+		},
+		{
+			name:    "sqlserver other error",
+			dialect: SQLServerDialect{},
+			err:     sqlServerError{number: 208},
+		},
+		{
+			name: "deadline of the caller",
+			err:  context.DeadlineExceeded,
+		},
+		{
+			name: "deadline of the lock timeout",
+			err:  &lockWaitError{err: fmt.Errorf("%w: %w", context.DeadlineExceeded, errors.New("canceled"))},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isLockTimeout(tt.dialect, tt.err))
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package igmigrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// metadataUpgrade changes the migration table from the previous layout version to its version.
+//
+// Upgrades must be idempotent, a migration table created by this release already has the latest layout
+// but it is still upgraded once to record its version.
+type metadataUpgrade struct {
+	version     int
+	description string
+	// column is the last column added by the upgrade, it finds the layout of tables without recorded version.
+	column  string
+	upgrade func(ctx context.Context, m *Migrator) error
+}
+
+// metadataUpgrades are layout versions of the migration table in order, version 1 is the table without path.
+// New columns are added as a new upgrade to the end, together with the CreateMigrationTable statements of dialects.
+var metadataUpgrades = []metadataUpgrade{
+	{
+		version:     2,
+		description: "add path column and primary key of path and version",
+		column:      "path",
+		upgrade:     upgradePath,
+	},
+	{
+		version:     3,
+		description: "add checksum column",
+		column:      "checksum",
+		upgrade: func(ctx context.Context, m *Migrator) error {
+			_, err := m.ensureColumn(ctx, "checksum", "VARCHAR(64)")
+
+			return err
+		},
+	},
+	{
+		version:     4,
+		description: "add file, duration_ms, applied_by, hostname and app_version columns",
+		column:      "app_version",
+		upgrade: func(ctx context.Context, m *Migrator) error {
+			columns := [][2]string{
+				{"file", "VARCHAR(255)"},
+				{"duration_ms", "BIGINT"},
+				{"applied_by", "VARCHAR(255)"},
+				{"hostname", "VARCHAR(255)"},
+				{"app_version", "VARCHAR(255)"},
+			}
+
+			for _, column := range columns {
+				if _, err := m.ensureColumn(ctx, column[0], column[1]); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	},
+}
+
+// MetadataVersion is the layout version of the migration table used by this release.
+func MetadataVersion() int {
+	return metadataUpgrades[len(metadataUpgrades)-1].version
+}
+
+// MetadataTable returns the table holding the layout version of the migration table, like `migration_metadata`.
+func (m *Migrator) MetadataTable() string {
+	return qualifiedName(m.Cnf.Schema, m.Cnf.MigrationTable+"_metadata")
+}
+
+// GetMetadataVersion returns the layout version of the migration table, 0 if it is not recorded yet.
+func (m *Migrator) GetMetadataVersion(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := m.Tx.QueryRowContext(ctx, "SELECT MAX(version) FROM "+m.MetadataTable()).Scan(&version)
+
+	return int(version.Int64), err
+}
+
+// MetadataTableExists reports whether the metadata table is already created.
+func (m *Migrator) MetadataTableExists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := m.Tx.QueryRowContext(ctx, m.dialectWithDefaults().TableExists(m.Cnf.Schema, m.Cnf.MigrationTable+"_metadata")).Scan(&exists)
+
+	return exists, err
+}
+
+// LayoutUpgrade is a pending upgrade of the migration table to the layout of this release, done by the next Migrate.
+type LayoutUpgrade struct {
+	Table string
+	From  int
+	To    int
+}
+
+func (u *LayoutUpgrade) String() string {
+	return fmt.Sprintf("migration table %s needs upgrade from layout version %d to %d", u.Table, u.From, u.To)
+}
+
+// err returns the upgrade as error wrapping ErrUpgradeRequired.
+func (u *LayoutUpgrade) err() error {
+	return &sentinelError{message: u.String() + ", run Migrate first", sentinel: ErrUpgradeRequired}
+}
+
+// checkMigrationTable reports whether the migration table exists and its pending layout upgrade,
+// for reads without the migration lock which do not upgrade the table.
+//
+// Tables of layout version 2 and later are read, checks of newer columns are skipped.
+// A table without path column returns error wrapping ErrUpgradeRequired.
+func (m *Migrator) checkMigrationTable(ctx context.Context) (bool, *LayoutUpgrade, error) {
+	tableExists, err := m.MigrationTableExists(ctx)
+	if err != nil || !tableExists {
+		return false, nil, err
+	}
+
+	current := 0
+
+	metadataExists, err := m.MetadataTableExists(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if metadataExists {
+		if current, err = m.GetMetadataVersion(ctx); err != nil {
+			return false, nil, err
+		}
+	}
+
+	// Tables of releases before the metadata table have no layout version.
+	if current == 0 {
+		if current, err = m.detectLayout(ctx); err != nil {
+			return false, nil, err
+		}
+	}
+
+	latest := MetadataVersion()
+	if current >= latest {
+		return true, nil, nil
+	}
+
+	upgrade := &LayoutUpgrade{Table: m.MigrationTable(), From: current, To: latest}
+	if current < 2 {
+		return false, nil, upgrade.err()
+	}
+
+	m.layout = current
+
+	return true, upgrade, nil
+}
+
+// detectLayout returns the layout version of a migration table without recorded version from its columns.
+func (m *Migrator) detectLayout(ctx context.Context) (int, error) {
+	layout := 1
+	for _, upgrade := range metadataUpgrades {
+		exists, err := m.columnExists(ctx, upgrade.column)
+		if err != nil {
+			return 0, err
+		}
+
+		if !exists {
+			break
+		}
+
+		layout = upgrade.version
+	}
+
+	return layout, nil
+}
+
+// hasLayout reports whether the migration table has the columns of the layout version.
+func (m *Migrator) hasLayout(version int) bool {
+	return m.layout == 0 || m.layout >= version
+}
+
+// upgradeRequired returns error wrapping ErrUpgradeRequired if the migration table is older than the layout version.
+func (m *Migrator) upgradeRequired(version int) error {
+	if m.hasLayout(version) {
+		return nil
+	}
+
+	return (&LayoutUpgrade{Table: m.MigrationTable(), From: m.layout, To: MetadataVersion()}).err()
+}
+
+// CreateMetadataTable creates the metadata table if not present.
+func (m *Migrator) CreateMetadataTable(ctx context.Context) error {
+	if _, err := m.Tx.ExecContext(ctx, m.dialectWithDefaults().CreateMetadataTable(m.MetadataTable())); err != nil {
+		return fmt.Errorf("failed to create metadata table: %w", err)
+	}
+
+	return nil
+}
+
+// upgradeMetadata upgrades the migration table to the latest layout.
+// It must be called with the migration lock, after the metadata table is created.
+//
+// Upgrades change the table with DDL, in MySQL they commit the transaction and release the lock of TableLocker,
+// the default MySQLLocker keeps the lock.
+func (m *Migrator) upgradeMetadata(ctx context.Context) error {
+	current, err := m.GetMetadataVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	latest := MetadataVersion()
+	if current >= latest {
+		return nil
+	}
+
+	for _, upgrade := range metadataUpgrades {
+		if upgrade.version <= current {
+			continue
+		}
+
+		if err := upgrade.upgrade(ctx, m); err != nil {
+			return fmt.Errorf("failed to upgrade migration table to version %d, %s: %w", upgrade.version, upgrade.description, err)
+		}
+	}
+
+	d := m.Dialect()
+	if _, err := m.Tx.ExecContext(ctx, "INSERT INTO "+m.MetadataTable()+"(version) VALUES ("+d.Placeholder(1)+")", latest); err != nil {
+		return err
+	}
+
+	m.Logger.Info("migration table upgraded", "table", m.MigrationTable(), "from", current, "to", latest)
+
+	return nil
+}
+
+// upgradePath adds the path column of v2 to a v1 migration table and moves the primary key to path and version.
+func upgradePath(ctx context.Context, m *Migrator) error {
+	// v1 tables only exist in PostgreSQL, other dialects are created with the path column.
+	added, err := m.ensureColumn(ctx, "path", "VARCHAR(1000) NOT NULL DEFAULT '/'")
+	if err != nil || !added {
+		return err
+	}
+
+	query := m.dialectWithDefaults().ReplacePrimaryKey(m.MigrationTable(), "path, version")
+	if query == "" {
+		return nil
+	}
+
+	_, err = m.Tx.ExecContext(ctx, query)
+
+	return err
+}
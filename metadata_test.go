@@ -0,0 +1,98 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator_UpgradeMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		current any
+		init    func(mck sqlmock.Sqlmock)
+	}{
+		{
+			name: "v1",
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'path'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN path VARCHAR\\(1000\\) NOT NULL DEFAULT '/'").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("DO \\$\\$ .* ALTER TABLE migration ADD PRIMARY KEY \\(path, version\\); END \\$\\$").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'checksum'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN checksum VARCHAR\\(64\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'file'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN file VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'duration_ms'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN duration_ms BIGINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'applied_by'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN applied_by VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'hostname'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN hostname VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'app_version'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN app_version VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("INSERT INTO migration_metadata\\(version\\) VALUES \\(\\$1\\)").WithArgs(MetadataVersion()).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name:    "v2",
+			current: 2,
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'checksum'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN checksum VARCHAR\\(64\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'file'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN file VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'duration_ms'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN duration_ms BIGINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'applied_by'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN applied_by VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'hostname'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN hostname VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'app_version'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN app_version VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("INSERT INTO migration_metadata\\(version\\) VALUES \\(\\$1\\)").WithArgs(MetadataVersion()).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name:    "v3",
+			current: 3,
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'file'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'duration_ms'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN duration_ms BIGINT").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'applied_by'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN applied_by VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'hostname'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN hostname VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema\\(\\) AND table_name = 'migration' AND column_name = 'app_version'\\)").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectExec("ALTER TABLE migration ADD COLUMN app_version VARCHAR\\(255\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("INSERT INTO migration_metadata\\(version\\) VALUES \\(\\$1\\)").WithArgs(MetadataVersion()).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+		},
+		{
+			name:    "latest",
+			current: MetadataVersion(),
+			init:    func(sqlmock.Sqlmock) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(tt.current))
+			tt.init(mck)
+
+			m, err := newMigrator(context.Background(), db, &Config{})
+			require.NoError(t, err)
+
+			require.NoError(t, m.upgradeMetadata(context.Background()))
+			require.NoError(t, mck.ExpectationsWereMet())
+		})
+	}
+}
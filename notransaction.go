@@ -0,0 +1,135 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"path"
+	"slices"
+	"time"
+)
+
+// isNonTransactional reports whether the migration file has the no-transaction directive.
+func (m *Migrator) isNonTransactional(filePath string) (bool, error) {
+	content, err := m.readFile(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	directives, err := ParseDirectives(content)
+	if err != nil {
+		return false, err
+	}
+
+	return directives.NoTransaction, nil
+}
+
+// migrateNonTransactional runs the migration file on Migrator.DB and records its version in Migrator.Tx.
+//
+// Migration table stays locked with Migrator.Tx while the file runs, so parallel migrations wait for it.
+// Without a SessionLocker the lock and the file use two connections, a pool limited to one connection blocks;
+// lockers taking no lock, like TableLocker of SQLiteDialect, run both on the same connection.
+// The file runs on a plain connection, so Config.Schema is not applied and it should use qualified names.
+func (m *Migrator) migrateNonTransactional(ctx context.Context, fileName string) error {
+	filePath := path.Join(m.Cnf.MigrationsDir, fileName)
+	directoryPath := getPath(fileName)
+	version := VersionFromFile(path.Base(fileName))
+
+	db, ok := m.DB.(execer)
+	if !ok {
+		return m.newMigrationError(ctx, fileName, version, errors.New("database connection cannot execute non-transactional migration"))
+	}
+
+	if err := m.AcquireLock(ctx); err != nil {
+		return err
+	}
+
+	// Another migration could have applied it before the lock.
+	applied, err := m.GetAppliedVersions(ctx, directoryPath)
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(applied, version) {
+		return nil
+	}
+
+	content, err := m.readFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	directives, err := ParseDirectives(content)
+	if err != nil {
+		return err
+	}
+
+	info := MigrationInfo{Path: directoryPath, File: fileName, Name: path.Base(fileName), Version: version}
+	if err := m.beforeMigration(ctx, info); err != nil {
+		return err
+	}
+
+	callbacks, err := m.getCallbacks(directoryPath)
+	if err != nil {
+		return err
+	}
+
+	if err := m.runCallback(ctx, callbacks.BeforeEach); err != nil {
+		return err
+	}
+
+	// Statements of the transaction cannot limit the plain connection, context deadline is used.
+	execCtx := ctx
+	if timeout := m.statementTimeout(ctx, directives); timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+
+		defer cancel()
+	}
+
+	start := time.Now()
+
+	rows, err := m.execMigration(execCtx, db, filePath, content)
+	if err != nil {
+		return m.newMigrationError(ctx, fileName, version, err)
+	}
+
+	info.Duration = time.Since(start)
+
+	fileChecksum, err := m.contentChecksum(filePath, content)
+	if err != nil {
+		return err
+	}
+
+	if err := m.InsertRecord(ctx, &MigrationRecord{
+		Path:     directoryPath,
+		Version:  version,
+		Checksum: fileChecksum,
+		File:     fileName,
+		Name:     path.Base(fileName),
+		Duration: info.Duration,
+	}); err != nil {
+		return err
+	}
+
+	m.files = append(m.files, AppliedMigration{
+		Path:         directoryPath,
+		File:         fileName,
+		Name:         path.Base(fileName),
+		Version:      version,
+		Duration:     info.Duration,
+		RowsAffected: rows,
+		Checksum:     fileChecksum,
+	})
+
+	if err := m.runCallback(ctx, callbacks.AfterEach); err != nil {
+		return err
+	}
+
+	if err := m.afterMigration(ctx, info); err != nil {
+		return err
+	}
+
+	m.Logger.Info("success run non-transactional migration", "migrated_to", version, "path", directoryPath, "migration_path", filePath)
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestParseDirectives(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Directives
+		wantErr bool
+	}{
+		{
+			name:    "no directives",
+			content: "-- create table\nCREATE TABLE test (id INT);\n",
+		},
+		{
+			name:    "no transaction",
+			content: "\n-- build index\n--igmigrator:no-transaction\nCREATE INDEX CONCURRENTLY test_idx ON test (id);\n",
+			want:    Directives{NoTransaction: true},
+		},
+		{
+			name:    "after statement",
+			content: "CREATE INDEX test_idx ON test (id);\n-- igmigrator:no-transaction\n",
+		},
+		{
+			name:    "statement timeout",
+			content: "-- igmigrator:statement-timeout 10m\nUPDATE test SET id = id + 1;\n",
+			want:    Directives{StatementTimeout: 10 * time.Minute},
+		},
+		{
+			name:    "invalid statement timeout",
+			content: "-- igmigrator:statement-timeout soon\nSELECT 1;\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown directive",
+			content: "-- igmigrator:no-lock\nSELECT 1;\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDirectives([]byte(tt.content))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMigrate_NoTransaction(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	expectPrepare := func(applied ...int) {
+		versions := sqlmock.NewRows([]string{"version"})
+		for _, version := range applied {
+			versions.AddRow(version)
+		}
+
+		expectPrepareDB(mck, "migration")
+		mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versions)
+		mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	}
+
+	mck.MatchExpectationsInOrder(true)
+
+	// First transaction stops before the non-transactional file.
+	mck.ExpectBegin()
+	expectPrepare()
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	// Non-transactional file runs on the connection while the migration table is locked.
+	mck.ExpectBegin()
+	mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mck.ExpectExec("CREATE INDEX CONCURRENTLY accounts_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	// Rest of the files run in a new transaction.
+	mck.ExpectBegin()
+	expectPrepare(1, 2)
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+	mck.ExpectExec("ALTER TABLE accounts ADD COLUMN name").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 3, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	result, err := Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("no_transaction")})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 3}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrate_NoTransactionWithoutLock(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	expectPrepare := func(applied ...int) {
+		versions := sqlmock.NewRows([]string{"version"})
+		for _, version := range applied {
+			versions.AddRow(version)
+		}
+
+		mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration").WillReturnResult(sqlmock.NewResult(0, 0))
+		mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+		mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+		mck.ExpectQuery("SELECT version FROM migration WHERE path = \\? ORDER BY version").WithArgs("/").WillReturnRows(versions)
+		mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\? AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	}
+
+	mck.MatchExpectationsInOrder(true)
+
+	mck.ExpectBegin()
+	expectPrepare()
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration WHERE path = \\?").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("INSERT INTO migration").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	// SQLite takes no lock, so the file and its record do not wait for a second connection.
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\? ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mck.ExpectExec("CREATE INDEX CONCURRENTLY accounts_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("INSERT INTO migration").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	mck.ExpectBegin()
+	expectPrepare(1, 2)
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration WHERE path = \\?").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+	mck.ExpectExec("ALTER TABLE accounts ADD COLUMN name").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("INSERT INTO migration").WithArgs(recordArgs("/", 3, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	result, err := Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("no_transaction"), Dialect: SQLiteDialect{}})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 3}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrateInTx_NoTransaction(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+
+	_, err = MigrateInTx(context.Background(), db, &Config{MigrationsDir: testdata.Path("no_transaction")})
+	assert.ErrorContains(t, err, "non-transactional migration requires Migrate with database connection")
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrateTo_NoTransaction(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	expectValidate := func(applied ...int) {
+		versions := sqlmock.NewRows([]string{"version"})
+		for _, version := range applied {
+			versions.AddRow(version)
+		}
+
+		mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versions)
+		mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	}
+
+	mck.MatchExpectationsInOrder(true)
+
+	// First transaction stops before the non-transactional file.
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	expectValidate()
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	mck.ExpectBegin()
+	mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mck.ExpectExec("CREATE INDEX CONCURRENTLY accounts_email_idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	// Rest of the files up to the target run in a new transaction.
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	expectValidate(1, 2)
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+	mck.ExpectExec("ALTER TABLE accounts ADD COLUMN name").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 3, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectCommit()
+
+	result, err := MigrateTo(context.Background(), db, &Config{MigrationsDir: testdata.Path("no_transaction")}, "/", 3)
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 3}, result.Path["/"])
+	assert.Len(t, result.Records, 3)
+	assert.Len(t, result.Files, 3)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	// Down files always run in the transaction.
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+	mck.ExpectRollback()
+
+	_, err = MigrateTo(context.Background(), db, &Config{MigrationsDir: testdata.Path("no_transaction")}, "/", 1)
+	assert.ErrorContains(t, err, "failed down migration on testdata/no_transaction/2_index_accounts_email.down.sql version 2: down migration cannot be non-transactional")
+	require.NoError(t, mck.ExpectationsWereMet())
+}
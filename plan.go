@@ -0,0 +1,256 @@
+package igmigrator
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MigratePlan holds migrations which would be run by Migrate.
+type MigratePlan struct {
+	// Dirs are in the same order as they would be migrated.
+	Dirs []DirPlan
+	// Upgrade is the pending layout upgrade of the migration table, nil if it is up to date or not created.
+	Upgrade *LayoutUpgrade
+}
+
+// DirPlan holds pending migrations of a single directory.
+type DirPlan struct {
+	Path        string
+	PrevVersion int
+	NewVersion  int
+	Files       []PlannedMigration
+	// Repeatable are new or changed repeatable migration files, run after the files.
+	Repeatable []string
+	// Callbacks run around the files, only if there are pending files.
+	Callbacks Callbacks
+}
+
+// PlannedMigration is a single pending migration file.
+type PlannedMigration struct {
+	File    string
+	Name    string
+	Version int
+	// NoTransaction is set for files with the `-- igmigrator:no-transaction` directive.
+	NoTransaction bool
+	// Rendered is the SQL of a template file, like `1_create.sql.tmpl`, empty for other files.
+	Rendered string
+	// Baseline is set for files recorded as applied without running them, see Config.BaselineVersion.
+	Baseline bool
+}
+
+// Plan reports migrations that Migrate would run without executing them.
+//
+// Migration table is not created if it does not exist, the transaction is always rolled back.
+func Plan(ctx context.Context, db DB, cnf *Config) (*MigratePlan, error) {
+	var plan *MigratePlan
+
+	err := inReadTx(ctx, db, func(tx Transaction) error {
+		var err error
+		plan, err = PlanInTx(ctx, tx, cnf)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// PlanInTx is the same as Plan but operates on the given transaction.
+func PlanInTx(ctx context.Context, tx Transaction, cnf *Config) (*MigratePlan, error) {
+	migration, err := newMigrator(ctx, tx, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	tableExists, upgrade, err := migration.checkMigrationTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Migrate records the baseline only on an empty migration table.
+	baseline := false
+	if cnf.BaselineVersion > 0 {
+		if baseline, err = migration.migrationTableEmpty(ctx, tableExists); err != nil {
+			return nil, err
+		}
+	}
+
+	dirs, err := migration.GetDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MigratePlan{Dirs: make([]DirPlan, 0, len(dirs)), Upgrade: upgrade}
+	for _, dir := range dirs {
+		lastVersion, migrations, err := migration.pendingMigrations(ctx, dir, tableExists)
+		if err != nil {
+			return nil, err
+		}
+
+		repeatables, err := migration.pendingRepeatables(ctx, dir, false)
+		if err != nil {
+			return nil, err
+		}
+
+		callbacks, err := migration.GetCallbacks(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		dirPlan := DirPlan{
+			Path:        dir,
+			PrevVersion: lastVersion,
+			NewVersion:  lastVersion,
+			Files:       make([]PlannedMigration, 0, len(migrations)),
+			Repeatable:  repeatables,
+			Callbacks:   callbacks,
+		}
+
+		for _, file := range migrations {
+			planned, err := migration.plannedMigration(file)
+			if err != nil {
+				return nil, err
+			}
+
+			planned.Baseline = baseline && planned.Version <= cnf.BaselineVersion
+
+			dirPlan.Files = append(dirPlan.Files, planned)
+
+			version := planned.Version
+
+			if version > dirPlan.NewVersion {
+				dirPlan.NewVersion = version
+			}
+		}
+
+		plan.Dirs = append(plan.Dirs, dirPlan)
+	}
+
+	return plan, nil
+}
+
+// plannedMigration returns planned migration of the file name relative to the migrations directory.
+func (m *Migrator) plannedMigration(fileName string) (PlannedMigration, error) {
+	planned := PlannedMigration{File: fileName, Name: path.Base(fileName), Version: VersionFromFile(path.Base(fileName))}
+
+	if _, ok := registeredMigration(fileName); ok {
+		return planned, nil
+	}
+
+	filePath := path.Join(m.Cnf.MigrationsDir, fileName)
+
+	nonTransactional, err := m.isNonTransactional(filePath)
+	if err != nil {
+		return planned, fmt.Errorf("failed to read %s: %w", fileName, err)
+	}
+
+	planned.NoTransaction = nonTransactional
+
+	if isTemplate(fileName) {
+		content, err := m.readFile(filePath)
+		if err != nil {
+			return planned, fmt.Errorf("failed to read %s: %w", fileName, err)
+		}
+
+		if planned.Rendered, err = m.render(filePath, content); err != nil {
+			return planned, fmt.Errorf("failed to render %s: %w", fileName, err)
+		}
+	}
+
+	return planned, nil
+}
+
+// Pending returns count of all pending migrations.
+func (p *MigratePlan) Pending() int {
+	count := 0
+	for _, dir := range p.Dirs {
+		count += len(dir.Files) + len(dir.Repeatable)
+	}
+
+	return count
+}
+
+// Result returns versions as Migrate would return after running the plan.
+func (p *MigratePlan) Result() *MigrateResult {
+	result := &MigrateResult{Path: make(map[string]MigrateResultVersion, len(p.Dirs))}
+	for _, dir := range p.Dirs {
+		result.Path[dir.Path] = MigrateResultVersion{
+			PrevVersion: dir.PrevVersion,
+			NewVersion:  dir.NewVersion,
+		}
+	}
+
+	return result
+}
+
+// String returns human readable plan.
+func (p *MigratePlan) String() string {
+	var sb strings.Builder
+
+	writeUpgrade(&sb, p.Upgrade)
+
+	for _, dir := range p.Dirs {
+		if len(dir.Files) == 0 && len(dir.Repeatable) == 0 {
+			fmt.Fprintf(&sb, "%s: up to date at version %d\n", dir.Path, dir.PrevVersion)
+
+			continue
+		}
+
+		fmt.Fprintf(&sb, "%s: %d -> %d\n", dir.Path, dir.PrevVersion, dir.NewVersion)
+
+		writeCallback(&sb, "before all", dir.Callbacks.BeforeAll)
+		writeCallback(&sb, "before each", dir.Callbacks.BeforeEach)
+
+		for _, file := range dir.Files {
+			switch {
+			case file.Baseline:
+				fmt.Fprintf(&sb, "  %d\t%s\tbaseline\n", file.Version, file.File)
+			case file.NoTransaction:
+				fmt.Fprintf(&sb, "  %d\t%s\tno transaction\n", file.Version, file.File)
+			default:
+				fmt.Fprintf(&sb, "  %d\t%s\n", file.Version, file.File)
+			}
+
+			writeRendered(&sb, file.Rendered)
+		}
+
+		writeCallback(&sb, "after each", dir.Callbacks.AfterEach)
+
+		for _, file := range dir.Repeatable {
+			fmt.Fprintf(&sb, "  repeatable\t%s\n", file)
+		}
+
+		writeCallback(&sb, "after all", dir.Callbacks.AfterAll)
+	}
+
+	return sb.String()
+}
+
+// writeUpgrade writes a line of the pending layout upgrade if it is set.
+func writeUpgrade(sb *strings.Builder, upgrade *LayoutUpgrade) {
+	if upgrade != nil {
+		fmt.Fprintf(sb, "%s\n", upgrade)
+	}
+}
+
+// writeCallback writes a line of the callback file if it is set.
+func writeCallback(sb *strings.Builder, name, file string) {
+	if file != "" {
+		fmt.Fprintf(sb, "  %s\t%s\n", name, file)
+	}
+}
+
+// writeRendered writes lines of the rendered template indented under the file.
+func writeRendered(sb *strings.Builder, rendered string) {
+	if strings.TrimSpace(rendered) == "" {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(rendered, "\n"), "\n") {
+		fmt.Fprintf(sb, "    | %s\n", line)
+	}
+}
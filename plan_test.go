@@ -0,0 +1,73 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestPlan(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectMigrationTable(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(2)))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/test").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/test/inner").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/test/other").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectRollback()
+
+	plan, err := Plan(context.Background(), db, &Config{MigrationsDir: testdata.Path("multi")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, []DirPlan{
+		{Path: "/", PrevVersion: 2, NewVersion: 2, Files: []PlannedMigration{}},
+		{Path: "/test", PrevVersion: 1, NewVersion: 10, Files: []PlannedMigration{
+			{File: "/test/10_test.sql", Name: "10_test.sql", Version: 10},
+		}},
+		{Path: "/test/inner", PrevVersion: 0, NewVersion: 30, Files: []PlannedMigration{
+			{File: "/test/inner/1_test.sql", Name: "1_test.sql", Version: 1},
+			{File: "/test/inner/20_test.sql", Name: "20_test.sql", Version: 20},
+			{File: "/test/inner/30_test.sql", Name: "30_test.sql", Version: 30},
+		}},
+		{Path: "/test/other", PrevVersion: 0, NewVersion: 0, Files: []PlannedMigration{}},
+	}, plan.Dirs)
+	assert.Equal(t, 4, plan.Pending())
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 1, NewVersion: 10}, plan.Result().Path["/test"])
+	assert.Equal(t, `/: up to date at version 2
+/test: 1 -> 10
+  10	/test/10_test.sql
+/test/inner: 0 -> 30
+  1	/test/inner/1_test.sql
+  20	/test/inner/20_test.sql
+  30	/test/inner/30_test.sql
+/test/other: up to date at version 0
+`, plan.String())
+}
+
+func TestPlan_NoMigrationTable(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.ExpectBegin()
+	mck.ExpectQuery("SELECT to_regclass\\('migration'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mck.ExpectRollback()
+
+	plan, err := Plan(context.Background(), db, &Config{MigrationsDir: testdata.Path("normal")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 3}, plan.Result().Path["/"])
+}
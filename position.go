@@ -0,0 +1,188 @@
+package igmigrator
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// sourceContextLines is the number of lines shown before and after the failed line.
+const sourceContextLines = 2
+
+// expansion is the migration after variables of Config.Values are replaced.
+type expansion struct {
+	text string
+	// replacements are replaced variables in order of the text.
+	replacements []replacement
+}
+
+// replacement is a variable of originalLength bytes at originalOffset of the file,
+// replaced by length bytes at offset of the expanded text.
+type replacement struct {
+	offset         int
+	length         int
+	originalOffset int
+	originalLength int
+}
+
+// originalOffset returns the byte offset in the file of the byte offset in the expanded text.
+// Offsets inside a replaced value point to the start of the variable.
+func (e *expansion) originalOffset(offset int) int {
+	delta := 0
+
+	for _, r := range e.replacements {
+		if offset < r.offset {
+			break
+		}
+
+		if offset < r.offset+r.length {
+			return r.originalOffset
+		}
+
+		delta = r.originalOffset + r.originalLength - r.offset - r.length
+	}
+
+	return offset + delta
+}
+
+// location returns line, column and source context of the error in the file, 0 and empty if the driver reports no position.
+func (e *execError) location() (int, int, string) {
+	position := errorPosition(e.err)
+	if position <= 0 || e.expansion == nil {
+		return 0, 0, ""
+	}
+
+	offset := e.expansion.originalOffset(e.offset + byteOffset(e.statement, position))
+	line, column := lineColumn(e.source, offset)
+
+	return line, column, sourceContext(e.source, line, column)
+}
+
+// positionFields are driver errors with a Position field of the statement, by package path and type name.
+// Drivers are not imported, the field is read with reflection only for these types and kinds.
+var positionFields = map[string]reflect.Kind{
+	// *pgconn.PgError of pgx v5 and v4.
+	"github.com/jackc/pgx/v5/pgconn.PgError": reflect.Int32,
+	"github.com/jackc/pgconn.PgError":        reflect.Int32,
+	// *pq.Error of lib/pq.
+	"github.com/lib/pq.Error": reflect.String,
+}
+
+// errorPosition returns the 1-based character position of the error in the statement, 0 if it is not reported.
+//
+// Errors in the chain report the position with a `Position() int` method or are one of positionFields.
+func errorPosition(err error) int {
+	var positionErr interface{ Position() int }
+	if errors.As(err, &positionErr) {
+		return positionErr.Position()
+	}
+
+	for ; err != nil; err = errors.Unwrap(err) {
+		if position := positionField(err); position > 0 {
+			return position
+		}
+	}
+
+	return 0
+}
+
+// positionField returns the Position field of the error, 0 if it is not one of positionFields.
+func positionField(err error) int {
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+
+	kind, ok := positionFields[v.Type().PkgPath()+"."+v.Type().Name()]
+	if !ok {
+		return 0
+	}
+
+	field := v.FieldByName("Position")
+	if field.Kind() != kind {
+		return 0
+	}
+
+	switch kind {
+	case reflect.Int32:
+		return int(field.Int())
+	case reflect.String:
+		position, _ := strconv.Atoi(field.String())
+
+		return position
+	}
+
+	return 0
+}
+
+// byteOffset returns the byte offset of the 1-based character position in text.
+func byteOffset(text string, position int) int {
+	n := 1
+	for i := range text {
+		if n == position {
+			return i
+		}
+
+		n++
+	}
+
+	return len(text)
+}
+
+// lineColumn returns the 1-based line and character column of the byte offset in content.
+func lineColumn(content string, offset int) (int, int) {
+	offset = min(offset, len(content))
+	lineStart := strings.LastIndexByte(content[:offset], '\n') + 1
+
+	return strings.Count(content[:offset], "\n") + 1, utf8.RuneCountInString(content[lineStart:offset]) + 1
+}
+
+// sourceContext returns lines of content around line, numbered and with a marker under column of the line.
+func sourceContext(content string, line, column int) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var sb strings.Builder
+	for i := max(line-sourceContextLines, 1); i <= min(line+sourceContextLines, len(lines)); i++ {
+		text := strings.TrimRight(lines[i-1], "\r")
+
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+
+		fmt.Fprintf(&sb, "%s %4d | %s\n", marker, i, text)
+
+		if i == line {
+			fmt.Fprintf(&sb, "       | %s^\n", indent(text, column-1))
+		}
+	}
+
+	return sb.String()
+}
+
+// indent returns whitespace as wide as the first n characters of text, keeping tabs.
+func indent(text string, n int) string {
+	var sb strings.Builder
+	for _, r := range text {
+		if n == 0 {
+			break
+		}
+
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+
+		n--
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,135 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrator_MigrateMultiple_ErrorPosition(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx: db,
+		Cnf: &Config{
+			MigrationsDir:  testdata.Path("position"),
+			MigrationTable: "migration",
+			Values:         map[string]string{"TABLE": "accounts_archive", "TYPE": "varchar(255)"},
+		},
+		Logger: logz.AdapterNoop{},
+	}
+
+	expanded := "CREATE TABLE accounts_archive (\n    id serial PRIMARY KEY,\n    name varchar(255) NOT NULL andd,\n    note text\n);\n"
+	position := utf8.RuneCountInString(expanded[:strings.Index(expanded, "andd")]) + 1
+
+	mck.ExpectExec("CREATE TABLE accounts_archive").
+		WillReturnError(&pgconn.PgError{Severity: "ERROR", Code: "42601", Message: `syntax error at or near "andd"`, Position: int32(position)})
+
+	_, err = m.MigrateMultiple(context.Background(), []string{"1_create_table.sql"}, 0)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	var migrationErr *MigrationError
+	require.ErrorAs(t, err, &migrationErr)
+	assert.Equal(t, expanded, migrationErr.Statement)
+	assert.Equal(t, 3, migrationErr.Line)
+	assert.Equal(t, 27, migrationErr.Column)
+	assert.Equal(t, `     1 | CREATE TABLE ${TABLE} (
+     2 |     id serial PRIMARY KEY,
+>    3 |     name ${TYPE} NOT NULL andd,
+       |                           ^
+     4 |     note text
+     5 | );
+`, migrationErr.Source)
+	assert.EqualError(t, err, `failed migration on testdata/position/1_create_table.sql:3:27 version 1: ERROR: syntax error at or near "andd" (SQLSTATE 42601)`)
+}
+
+// pqError has the Position field of *pq.Error of lib/pq, it is matched only if it is added to positionFields.
+type pqError struct {
+	Message  string
+	Position string
+}
+
+func (e *pqError) Error() string {
+	return e.Message
+}
+
+// otherError has a Position field but it is not a known driver error.
+type otherError struct {
+	Position int
+}
+
+func (e *otherError) Error() string {
+	return "other"
+}
+
+func TestErrorPosition(t *testing.T) {
+	pqType := reflect.TypeOf(pqError{})
+	pqName := pqType.PkgPath() + "." + pqType.Name()
+
+	positionFields[pqName] = reflect.String
+	t.Cleanup(func() { delete(positionFields, pqName) })
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "pgx",
+			err:  &pgconn.PgError{Message: "syntax error", Position: 12},
+			want: 12,
+		},
+		{
+			name: "lib/pq",
+			err:  fmt.Errorf("exec: %w", &pqError{Message: "syntax error", Position: "7"}),
+			want: 7,
+		},
+		{
+			name: "without position",
+			err:  &pqError{Message: "connection refused"},
+		},
+		{
+			name: "unknown type",
+			err:  &otherError{Position: 5},
+		},
+		{
+			name: "not a struct",
+			err:  errors.New("syntax error"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errorPosition(tt.err))
+		})
+	}
+}
+
+func TestLineColumn(t *testing.T) {
+	content := "SELECT 1;\n\tSELECT 'ä' + x;\n"
+
+	line, column := lineColumn(content, strings.Index(content, "x"))
+	assert.Equal(t, 2, line)
+	assert.Equal(t, 15, column)
+
+	line, column = lineColumn(content, 0)
+	assert.Equal(t, 1, line)
+	assert.Equal(t, 1, column)
+
+	assert.Equal(t, strings.Index(content, "x"), byteOffset(content, utf8.RuneCountInString(content[:strings.Index(content, "x")])+1))
+}
@@ -0,0 +1,89 @@
+package igmigrator
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GoMigrationSuffix is the suffix of Go migration names, listed as `<version>.go` with migration files.
+const GoMigrationSuffix = ".go"
+
+// MigrationFunc is a migration written in Go.
+// It runs in the same transaction as SQL migration files.
+type MigrationFunc func(ctx context.Context, tx Transaction) error
+
+var registry = struct {
+	sync.RWMutex
+	funcs map[string]map[int]MigrationFunc
+}{
+	funcs: make(map[string]map[int]MigrationFunc),
+}
+
+// Register adds a Go migration to the directory with the version, like `Register("/", 5, fn)`.
+//
+// Go migrations are merged with the SQL files of the directory by version and recorded like them.
+// Directory path is relative to the migrations directory and the directory must exist.
+//
+// Go migrations have no down step, MigrateTo and MigrateDown below a Go migration
+// return an error wrapping ErrMissingFile.
+//
+// It panics if fn is nil or the version is already registered for the directory.
+func Register(directoryPath string, version int, fn MigrationFunc) {
+	if fn == nil {
+		panic("igmigrator: Register migration func is nil")
+	}
+
+	directoryPath = cleanPath(directoryPath)
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.funcs[directoryPath] == nil {
+		registry.funcs[directoryPath] = make(map[int]MigrationFunc)
+	}
+
+	if _, ok := registry.funcs[directoryPath][version]; ok {
+		panic(fmt.Sprintf("igmigrator: Register called twice for %s version %d", directoryPath, version))
+	}
+
+	registry.funcs[directoryPath][version] = fn
+}
+
+// registeredMigrations returns names of Go migrations of the directory above lastVersion.
+func registeredMigrations(directoryPath string, lastVersion int) []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.funcs[directoryPath]))
+	for version := range registry.funcs[directoryPath] {
+		if version > lastVersion {
+			names = append(names, strconv.Itoa(version)+GoMigrationSuffix)
+		}
+	}
+
+	return names
+}
+
+// registeredMigration returns Go migration of the file name relative to the migrations directory, like `/test/5.go`.
+func registeredMigration(fileName string) (MigrationFunc, bool) {
+	base := path.Base(fileName)
+	if !strings.HasSuffix(base, GoMigrationSuffix) {
+		return nil, false
+	}
+
+	version, err := strconv.Atoi(strings.TrimSuffix(base, GoMigrationSuffix))
+	if err != nil {
+		return nil, false
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+
+	fn, ok := registry.funcs[getPath(fileName)][version]
+
+	return fn, ok
+}
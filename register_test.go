@@ -0,0 +1,71 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestRegister(t *testing.T) {
+	called := false
+
+	Register("", 2, func(ctx context.Context, tx Transaction) error {
+		called = true
+
+		_, err := tx.ExecContext(ctx, "UPDATE accounts SET last_login = NOW()")
+
+		return err
+	})
+
+	t.Cleanup(func() {
+		registry.Lock()
+		delete(registry.funcs, "/")
+		registry.Unlock()
+	})
+
+	assert.Panics(t, func() {
+		Register("/", 2, func(context.Context, Transaction) error { return nil })
+	})
+
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx:     db,
+		Cnf:    &Config{MigrationsDir: testdata.Path("locking"), MigrationTable: "migration"},
+		Logger: logz.AdapterNoop{},
+	}
+
+	files, err := m.GetMigrationFiles(testdata.Path("locking"), 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"1_install_table.sql", "2.go"}, files)
+
+	files, err = m.GetMigrationFiles(testdata.Path("locking"), 2)
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	mck.ExpectExec("UPDATE accounts SET last_login = NOW\\(\\)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, nil)...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	newVersion, err := m.MigrateMultiple(context.Background(), []string{"1_install_table.sql", "2.go"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, newVersion)
+	assert.True(t, called)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	// Go migrations have no down step.
+	_, err = m.GetDownMigrationFile(testdata.Path("locking"), 2)
+	assert.ErrorIs(t, err, ErrMissingFile)
+}
@@ -0,0 +1,302 @@
+package igmigrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// RepairKind is the type of a repair operation.
+type RepairKind string
+
+const (
+	// RepairMarkApplied records a version as applied without running it, with the checksum of its file.
+	RepairMarkApplied RepairKind = "mark_applied"
+	// RepairUnmark removes an applied version without running its down file.
+	RepairUnmark RepairKind = "unmark"
+	// RepairChecksums records current checksums of applied files which are changed or recorded without checksum.
+	RepairChecksums RepairKind = "checksums"
+	// RepairOrphanedPaths removes applied versions of directories which do not exist in the migrations directory.
+	RepairOrphanedPaths RepairKind = "orphaned_paths"
+)
+
+// RepairOperation is a single change on the migration table.
+type RepairOperation struct {
+	Kind RepairKind
+	// Path is the directory relative to the migrations directory, like `/` or `/test`.
+	// It is required for RepairMarkApplied and RepairUnmark, RepairChecksums repairs all directories if it is empty.
+	Path string
+	// Version is used by RepairMarkApplied and RepairUnmark.
+	Version int
+}
+
+// RepairChange is a row of the migration table changed by Repair.
+type RepairChange struct {
+	Kind    RepairKind
+	Path    string
+	Version int
+	Message string
+}
+
+// RepairReport holds all changes done by Repair.
+type RepairReport struct {
+	Changes []RepairChange
+}
+
+// String returns changes line by line.
+func (r *RepairReport) String() string {
+	var sb strings.Builder
+
+	for _, change := range r.Changes {
+		fmt.Fprintf(&sb, "%s: %s\n", change.Kind, change.Message)
+	}
+
+	return sb.String()
+}
+
+// Repair fixes the migration table after manual changes on the database, without running any migration.
+//
+// Operations run in order in a single transaction after the migration lock is acquired,
+// every change is logged and returned in the report.
+func Repair(ctx context.Context, db DB, cnf *Config, operations ...RepairOperation) (*RepairReport, error) {
+	var report *RepairReport
+
+	err := inTx(ctx, db, func(tx Transaction) error {
+		var err error
+		report, err = RepairInTx(ctx, tx, cnf, operations...)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// RepairInTx is the same as Repair but operates on the given transaction.
+func RepairInTx(ctx context.Context, tx Transaction, cnf *Config, operations ...RepairOperation) (*RepairReport, error) {
+	migration, err := newMigrator(ctx, tx, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migration.prepareDB(ctx); err != nil {
+		return nil, err
+	}
+
+	report := &RepairReport{}
+	for _, operation := range operations {
+		var changes []RepairChange
+
+		switch operation.Kind {
+		case RepairMarkApplied:
+			changes, err = migration.repairMarkApplied(ctx, cleanPath(operation.Path), operation.Version)
+		case RepairUnmark:
+			changes, err = migration.repairUnmark(ctx, cleanPath(operation.Path), operation.Version)
+		case RepairChecksums:
+			changes, err = migration.repairChecksums(ctx, operation.Path)
+		case RepairOrphanedPaths:
+			changes, err = migration.repairOrphanedPaths(ctx)
+		default:
+			err = fmt.Errorf("unknown repair operation %q", operation.Kind)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("repair %s: %w", operation.Kind, err)
+		}
+
+		for _, change := range changes {
+			migration.Logger.Info(change.Message, "path", change.Path, "version", change.Version, "repair", string(change.Kind))
+		}
+
+		report.Changes = append(report.Changes, changes...)
+	}
+
+	return report, nil
+}
+
+func (m *Migrator) repairMarkApplied(ctx context.Context, dir string, version int) ([]RepairChange, error) {
+	applied, err := m.GetAppliedVersions(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(applied, version) {
+		return nil, fmt.Errorf("version %d of %s is already applied", version, dir)
+	}
+
+	files, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), -1)
+	if err != nil {
+		return nil, err
+	}
+
+	index := slices.IndexFunc(files, func(file string) bool { return VersionFromFile(file) == version })
+	if index < 0 {
+		return nil, &sentinelError{message: fmt.Sprintf("no migration file with version %d in %s", version, dir), sentinel: ErrMissingFile}
+	}
+
+	fileChecksum, err := m.fileChecksum(dir, files[index])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.InsertRecord(ctx, &MigrationRecord{Path: dir, Version: version, Checksum: fileChecksum, File: path.Join(dir, files[index]), Name: files[index]}); err != nil {
+		return nil, err
+	}
+
+	return []RepairChange{{
+		Kind:    RepairMarkApplied,
+		Path:    dir,
+		Version: version,
+		Message: fmt.Sprintf("marked %s version %d as applied", path.Join(dir, files[index]), version),
+	}}, nil
+}
+
+func (m *Migrator) repairUnmark(ctx context.Context, dir string, version int) ([]RepairChange, error) {
+	applied, err := m.GetAppliedVersions(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(applied, version) {
+		return nil, fmt.Errorf("version %d of %s is not applied", version, dir)
+	}
+
+	if err := m.DeleteVersion(ctx, dir, version); err != nil {
+		return nil, err
+	}
+
+	return []RepairChange{{
+		Kind:    RepairUnmark,
+		Path:    dir,
+		Version: version,
+		Message: fmt.Sprintf("unmarked %s version %d", dir, version),
+	}}, nil
+}
+
+// repairChecksums updates checksums of the directory, or of all directories if dir is empty.
+func (m *Migrator) repairChecksums(ctx context.Context, dir string) ([]RepairChange, error) {
+	dirs := []string{cleanPath(dir)}
+	if dir == "" {
+		var err error
+		if dirs, err = m.GetDirs(); err != nil {
+			return nil, err
+		}
+	}
+
+	var changes []RepairChange
+	for _, dir := range dirs {
+		applied, err := m.GetAppliedVersions(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		checksums, err := m.GetAppliedChecksums(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), -1)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, file := range files {
+			version := VersionFromFile(file)
+
+			// Only first file of a version is recorded.
+			if (i > 0 && VersionFromFile(files[i-1]) == version) || !slices.Contains(applied, version) {
+				continue
+			}
+
+			current, err := m.fileChecksum(dir, file)
+			if err != nil {
+				return nil, err
+			}
+
+			previous := checksums[version]
+			if current == previous {
+				continue
+			}
+
+			if err := m.UpdateChecksum(ctx, dir, version, current); err != nil {
+				return nil, err
+			}
+
+			if previous == "" {
+				previous = "none"
+			}
+
+			changes = append(changes, RepairChange{
+				Kind:    RepairChecksums,
+				Path:    dir,
+				Version: version,
+				Message: fmt.Sprintf("updated checksum of %s version %d from %s to %s", path.Join(dir, file), version, previous, current),
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+func (m *Migrator) repairOrphanedPaths(ctx context.Context) ([]RepairChange, error) {
+	dirs, err := m.GetDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := m.History(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RepairChange
+	for _, record := range history {
+		if slices.Contains(dirs, record.Path) {
+			continue
+		}
+
+		if err := m.DeleteVersion(ctx, record.Path, record.Version); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, RepairChange{
+			Kind:    RepairOrphanedPaths,
+			Path:    record.Path,
+			Version: record.Version,
+			Message: fmt.Sprintf("removed %s version %d of not existing directory", record.Path, record.Version),
+		})
+	}
+
+	return changes, nil
+}
+
+// fileChecksum returns checksum of the migration file in the directory, empty for Go migrations.
+func (m *Migrator) fileChecksum(dir, file string) (string, error) {
+	if _, ok := registeredMigration(path.Join(dir, file)); ok {
+		return "", nil
+	}
+
+	filePath := path.Join(m.Cnf.MigrationsDir, dir, file)
+
+	content, err := m.readFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return m.contentChecksum(filePath, content)
+}
+
+// UpdateChecksum replaces recorded checksum of the applied version.
+func (m *Migrator) UpdateChecksum(ctx context.Context, directoryPath string, version int, checksum string) error {
+	d := m.Dialect()
+	_, err := m.Tx.ExecContext(ctx, "UPDATE "+m.MigrationTable()+" SET checksum = "+d.Placeholder(1)+
+		" WHERE path = "+d.Placeholder(2)+" AND version = "+d.Placeholder(3),
+		sql.NullString{String: checksum, Valid: checksum != ""}, directoryPath, version)
+
+	return err
+}
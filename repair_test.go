@@ -0,0 +1,130 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestRepair(t *testing.T) {
+	const (
+		checksum1 = "39fb524dedf0dec974b13d3f89c08d947c7a707e6e888ee41da510706551a19a"
+		checksum2 = "6b0c32bbf88b964bd06179e5552305c05fa638615c340d73952f53385895d7f6"
+	)
+
+	versionRows := func(versions ...int) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"version"})
+		for _, version := range versions {
+			rows.AddRow(version)
+		}
+
+		return rows
+	}
+
+	tests := []struct {
+		name      string
+		operation RepairOperation
+		expect    func(mck sqlmock.Sqlmock)
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "mark applied",
+			operation: RepairOperation{Kind: RepairMarkApplied, Path: "/", Version: 2},
+			expect: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versionRows(1))
+				expectCurrentUser(mck)
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, checksum2)...).WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			want: "mark_applied: marked /2_create_users.sql version 2 as applied\n",
+		},
+		{
+			name:      "mark applied without file",
+			operation: RepairOperation{Kind: RepairMarkApplied, Path: "/", Version: 4},
+			expect: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versionRows(1))
+			},
+			wantErr: "repair mark_applied: no migration file with version 4 in /",
+		},
+		{
+			name:      "unmark",
+			operation: RepairOperation{Kind: RepairUnmark, Path: "/", Version: 3},
+			expect: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versionRows(1, 2, 3))
+				mck.ExpectExec("DELETE FROM migration WHERE path = \\$1 AND version = \\$2").WithArgs("/", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			want: "unmark: unmarked / version 3\n",
+		},
+		{
+			name:      "unmark not applied",
+			operation: RepairOperation{Kind: RepairUnmark, Path: "/", Version: 3},
+			expect: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versionRows(1))
+			},
+			wantErr: "repair unmark: version 3 of / is not applied",
+		},
+		{
+			name:      "checksums",
+			operation: RepairOperation{Kind: RepairChecksums},
+			expect: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versionRows(1, 2))
+				mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").
+					WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}).AddRow(2, "0000"))
+				mck.ExpectExec("UPDATE migration SET checksum = \\$1 WHERE path = \\$2 AND version = \\$3").WithArgs(checksum1, "/", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mck.ExpectExec("UPDATE migration SET checksum = \\$1 WHERE path = \\$2 AND version = \\$3").WithArgs(checksum2, "/", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			want: "checksums: updated checksum of /1_create_accounts.sql version 1 from none to " + checksum1 + "\n" +
+				"checksums: updated checksum of /2_create_users.sql version 2 from 0000 to " + checksum2 + "\n",
+		},
+		{
+			name:      "orphaned paths",
+			operation: RepairOperation{Kind: RepairOrphanedPaths},
+			expect: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT path, version, migrated_on, checksum, file, duration_ms, applied_by, hostname, app_version FROM migration ORDER BY path, version").
+					WillReturnRows(sqlmock.NewRows([]string{"path", "version", "migrated_on", "checksum", "file", "duration_ms", "applied_by", "hostname", "app_version"}).
+						AddRow("/", 1, time.Now(), checksum1, "1_create_accounts.sql", 12, "migrator", "pod-1", nil).
+						AddRow("/old", 3, time.Now(), nil, nil, nil, nil, nil, nil))
+				mck.ExpectExec("DELETE FROM migration WHERE path = \\$1 AND version = \\$2").WithArgs("/old", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			want: "orphaned_paths: removed /old version 3 of not existing directory\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			expectPrepareDB(mck, "migration")
+			tt.expect(mck)
+
+			if tt.wantErr != "" {
+				mck.ExpectRollback()
+			} else {
+				mck.ExpectCommit()
+			}
+
+			report, err := Repair(context.Background(), db, &Config{MigrationsDir: testdata.Path("baseline")}, tt.operation)
+			require.NoError(t, mck.ExpectationsWereMet())
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, report.String())
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package igmigrator
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RepeatablePrefix starts names of repeatable migration files, like `R_views.sql`.
+//
+// Repeatable migrations run after versioned migrations of the directory whenever their checksum changes.
+const RepeatablePrefix = "R_"
+
+// GetRepeatableFiles returns names of repeatable migration files in the directory sorted by name.
+// Down files like `R_views.down.sql` are not repeatable migrations.
+func (m *Migrator) GetRepeatableFiles(migrationDir string) ([]string, error) {
+	files, err := m.readdir(migrationDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var repeatables []string
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), RepeatablePrefix) || !isSQLFile(file.Name()) || isDownMigrationFile(file.Name()) {
+			continue
+		}
+
+		repeatables = append(repeatables, file.Name())
+	}
+
+	sort.Strings(repeatables)
+
+	return repeatables, nil
+}
+
+// RepeatableTable returns the table holding checksums of applied repeatable migrations, like `migration_repeatable`.
+func (m *Migrator) RepeatableTable() string {
+	return qualifiedName(m.Cnf.Schema, m.Cnf.MigrationTable+"_repeatable")
+}
+
+// CreateRepeatableTable creates the repeatable migration table if not present.
+func (m *Migrator) CreateRepeatableTable(ctx context.Context) error {
+	_, err := m.Tx.ExecContext(ctx, m.dialectWithDefaults().CreateRepeatableTable(m.RepeatableTable()))
+
+	return err
+}
+
+// createRepeatableTable creates the repeatable migration table if any directory has repeatable migration files.
+func (m *Migrator) createRepeatableTable(ctx context.Context) error {
+	dirs, err := m.GetDirs()
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		files, err := m.GetRepeatableFiles(path.Join(m.Cnf.MigrationsDir, dir))
+		if err != nil {
+			return err
+		}
+
+		if len(files) > 0 {
+			return m.CreateRepeatableTable(ctx)
+		}
+	}
+
+	return nil
+}
+
+// RepeatableTableExists checks if the repeatable migration table exists.
+func (m *Migrator) RepeatableTableExists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := m.Tx.QueryRowContext(ctx, m.dialectWithDefaults().TableExists(m.Cnf.Schema, m.Cnf.MigrationTable+"_repeatable")).Scan(&exists)
+
+	return exists, err
+}
+
+// GetRepeatableChecksums returns checksums of applied repeatable migrations of the directory by file name.
+func (m *Migrator) GetRepeatableChecksums(ctx context.Context, directoryPath string) (map[string]string, error) {
+	rows, err := m.Tx.QueryContext(ctx, "SELECT name, checksum FROM "+m.RepeatableTable()+" WHERE path = "+m.Dialect().Placeholder(1), directoryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := make(map[string]string)
+	for rows.Next() {
+		var name, checksum string
+		if err := rows.Scan(&name, &checksum); err != nil {
+			return nil, err
+		}
+
+		checksums[name] = checksum
+	}
+
+	return checksums, rows.Err()
+}
+
+// SaveRepeatable records checksum of the applied repeatable migration.
+func (m *Migrator) SaveRepeatable(ctx context.Context, directoryPath, name, checksum string) error {
+	d := m.Dialect()
+
+	if _, err := m.Tx.ExecContext(ctx, "DELETE FROM "+m.RepeatableTable()+" WHERE path = "+d.Placeholder(1)+" AND name = "+d.Placeholder(2), directoryPath, name); err != nil {
+		return err
+	}
+
+	_, err := m.Tx.ExecContext(ctx, "INSERT INTO "+m.RepeatableTable()+"(path, name, checksum) VALUES ("+
+		d.Placeholder(1)+", "+d.Placeholder(2)+", "+d.Placeholder(3)+")",
+		directoryPath, name, checksum)
+
+	return err
+}
+
+// pendingRepeatables returns repeatable migrations of the directory which are new or changed.
+// Files are joined with the directory path, relative to the migrations directory.
+//
+// If prepared is true, the repeatable migration table is already created by prepareDB,
+// otherwise it is only queried if it exists.
+func (m *Migrator) pendingRepeatables(ctx context.Context, dir string, prepared bool) ([]string, error) {
+	files, err := m.GetRepeatableFiles(path.Join(m.Cnf.MigrationsDir, dir))
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	tableExists := true
+	if !prepared {
+		if tableExists, err = m.RepeatableTableExists(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	applied := map[string]string{}
+	if tableExists {
+		if applied, err = m.GetRepeatableChecksums(ctx, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var pending []string
+	for _, file := range files {
+		filePath := path.Join(m.Cnf.MigrationsDir, dir, file)
+
+		content, err := m.readFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+
+		current, err := m.contentChecksum(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+
+		if applied[file] != current {
+			pending = append(pending, path.Join(dir, file))
+		}
+	}
+
+	return pending, nil
+}
+
+// migrateRepeatables runs repeatable migrations and records their checksums.
+func (m *Migrator) migrateRepeatables(ctx context.Context, repeatables []string) error {
+	for _, fileName := range repeatables {
+		filePath := path.Join(m.Cnf.MigrationsDir, fileName)
+
+		start := time.Now()
+
+		checksum, rowsAffected, err := m.migrateFile(ctx, filePath)
+		if err != nil {
+			return m.newMigrationError(ctx, fileName, 0, err)
+		}
+
+		duration := time.Since(start)
+
+		if err := m.SaveRepeatable(ctx, getPath(fileName), path.Base(fileName), checksum); err != nil {
+			return err
+		}
+
+		m.files = append(m.files, AppliedMigration{
+			Path:         getPath(fileName),
+			File:         fileName,
+			Name:         path.Base(fileName),
+			Duration:     duration,
+			RowsAffected: rowsAffected,
+			Checksum:     checksum,
+		})
+
+		m.Logger.Info("success run repeatable migration", "path", getPath(fileName), "migration_path", filePath)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrate_Repeatable(t *testing.T) {
+	const viewChecksum = "168c95ff3a3297b7b95db7fb7e02c7c5ab5df995440b310d7d72e652826cd459"
+
+	tests := []struct {
+		name     string
+		applied  []int
+		checksum string
+		run      bool
+		files    []string
+	}{
+		{
+			name:  "new",
+			run:   true,
+			files: []string{"1_create_accounts.sql", "R_account_names.sql"},
+		},
+		{
+			name:     "changed",
+			applied:  []int{1},
+			checksum: "0000",
+			run:      true,
+			files:    []string{"R_account_names.sql"},
+		},
+		{
+			name:     "unchanged",
+			applied:  []int{1},
+			checksum: viewChecksum,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			versions := sqlmock.NewRows([]string{"version"})
+			for _, version := range tt.applied {
+				versions.AddRow(version)
+			}
+
+			checksums := sqlmock.NewRows([]string{"name", "checksum"})
+			if tt.checksum != "" {
+				checksums.AddRow("R_account_names.sql", tt.checksum)
+			}
+
+			lastVersion := sqlmock.NewRows([]string{"version"}).AddRow(nil)
+			if len(tt.applied) > 0 {
+				lastVersion = sqlmock.NewRows([]string{"version"}).AddRow(int64(1))
+			}
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration").WillReturnResult(sqlmock.NewResult(0, 0))
+			mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_metadata").WillReturnResult(sqlmock.NewResult(0, 0))
+			// Repeatable table is created before the lock, like the other tables.
+			mck.ExpectExec("CREATE TABLE IF NOT EXISTS migration_repeatable").WillReturnResult(sqlmock.NewResult(0, 0))
+			mck.ExpectExec("lock table migration in ACCESS EXCLUSIVE mode").WillReturnResult(sqlmock.NewResult(0, 0))
+			mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(MetadataVersion()))
+			mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(versions)
+			mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+			mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(lastVersion)
+			mck.ExpectQuery("SELECT name, checksum FROM migration_repeatable WHERE path = \\$1").WithArgs("/").WillReturnRows(checksums)
+
+			if len(tt.applied) == 0 {
+				mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+				expectCurrentUser(mck)
+				mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			if tt.run {
+				mck.ExpectExec("CREATE OR REPLACE VIEW account_names").WillReturnResult(sqlmock.NewResult(0, 0))
+				mck.ExpectExec("DELETE FROM migration_repeatable WHERE path = \\$1 AND name = \\$2").WithArgs("/", "R_account_names.sql").WillReturnResult(sqlmock.NewResult(0, 1))
+				mck.ExpectExec("INSERT INTO migration_repeatable\\(path, name, checksum\\)").WithArgs("/", "R_account_names.sql", viewChecksum).WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			mck.ExpectCommit()
+
+			result, err := Migrate(context.Background(), db, &Config{MigrationsDir: testdata.Path("repeatable")})
+			require.NoError(t, err)
+			assert.Equal(t, MigrateResultVersion{PrevVersion: len(tt.applied), NewVersion: 1}, result.Path["/"])
+			require.NoError(t, mck.ExpectationsWereMet())
+
+			var files []string
+			for _, file := range result.Files {
+				files = append(files, file.Name)
+			}
+
+			assert.Equal(t, tt.files, files)
+
+			if tt.run {
+				repeatable := result.Files[len(result.Files)-1]
+				assert.Equal(t, 0, repeatable.Version)
+				assert.Equal(t, viewChecksum, repeatable.Checksum)
+			}
+		})
+	}
+}
+
+func TestPlan_Repeatable(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.ExpectBegin()
+	expectMigrationTable(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+	mck.ExpectQuery("SELECT to_regclass\\('migration_repeatable'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mck.ExpectQuery("SELECT name, checksum FROM migration_repeatable WHERE path = \\$1").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "checksum"}).AddRow("R_account_names.sql", "0000"))
+	mck.ExpectRollback()
+
+	plan, err := Plan(context.Background(), db, &Config{MigrationsDir: testdata.Path("repeatable")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, 1, plan.Pending())
+	assert.Equal(t, `/: 1 -> 1
+  repeatable	/R_account_names.sql
+`, plan.String())
+}
+
+func TestMigrator_MigrateRepeatables_MigrationError(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{Tx: db, Cnf: &Config{MigrationsDir: testdata.Path("repeatable")}, Logger: logz.AdapterNoop{}}
+
+	driverErr := errors.New(`relation "accounts" does not exist`)
+	mck.ExpectExec("CREATE OR REPLACE VIEW account_names").WillReturnError(driverErr)
+
+	err = m.migrateRepeatables(context.Background(), []string{"/R_account_names.sql"})
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	var migrationErr *MigrationError
+	require.ErrorAs(t, err, &migrationErr)
+	assert.Equal(t, "/", migrationErr.Path)
+	assert.Equal(t, 0, migrationErr.Version)
+	assert.ErrorIs(t, err, driverErr)
+	assert.EqualError(t, err, `failed repeatable migration on testdata/repeatable/R_account_names.sql: relation "accounts" does not exist`)
+}
@@ -0,0 +1,378 @@
+package igmigrator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Statement is a single statement of a migration file.
+type Statement struct {
+	// Text is the statement without surrounding whitespace and separator.
+	Text string
+	// Offset is the byte offset of Text in the split SQL.
+	Offset int
+}
+
+// splitRules is the syntax of a dialect needed to find the end of statements.
+type splitRules struct {
+	// dollarQuotes are PostgreSQL strings like `$$ ... $$` and `$body$ ... $body$`,
+	// also enables `E'...'` strings with backslash escapes.
+	dollarQuotes bool
+	// nestedComments are block comments inside block comments, like in PostgreSQL.
+	nestedComments bool
+	// backslashEscapes are escapes in all quoted strings, like in MySQL.
+	backslashEscapes bool
+	// hashComments are comments starting with `#`, like in MySQL.
+	hashComments bool
+	// backticks are identifiers quoted with backticks, like in MySQL.
+	backticks bool
+	// brackets are identifiers quoted with brackets, like `[name]` in SQL Server.
+	brackets bool
+	// batchSeparator is a keyword on its own line separating statements instead of semicolons, like `GO` in SQL Server.
+	batchSeparator string
+}
+
+// splitStatements splits sql into statements separated by semicolons or the batch separator.
+//
+// Separators in quoted strings, identifiers and comments are skipped, also semicolons in `BEGIN ... END` blocks
+// like bodies of triggers and procedures. Statements with only comments are dropped.
+// A batch separator with a count, like `GO 3`, repeats the batch before it count times.
+func splitStatements(sql string, rules splitRules) []Statement {
+	var (
+		statements []Statement
+		start      int
+		hasCode    bool
+		// depth is the count of open BEGIN and CASE blocks.
+		depth int
+	)
+
+	add := func(end int) {
+		if hasCode {
+			text := strings.TrimSpace(sql[start:end])
+			statements = append(statements, Statement{
+				Text:   text,
+				Offset: start + strings.Index(sql[start:end], text),
+			})
+		}
+
+		hasCode = false
+		depth = 0
+	}
+
+	for i := 0; i < len(sql); {
+		if end := skipComment(sql, i, rules); end > i {
+			i = end
+
+			continue
+		}
+
+		if end := skipString(sql, i, rules); end > i {
+			i = end
+			hasCode = true
+
+			continue
+		}
+
+		c := sql[i]
+
+		switch {
+		case c == '"':
+			i = skipQuoted(sql, i, '"', false)
+			hasCode = true
+		case c == '`' && rules.backticks:
+			i = skipQuoted(sql, i, '`', false)
+			hasCode = true
+		case c == '[' && rules.brackets:
+			i = skipQuoted(sql, i, ']', false)
+			hasCode = true
+		case c == ';' && rules.batchSeparator == "":
+			if depth > 0 {
+				i++
+
+				continue
+			}
+
+			add(i)
+			i++
+			start = i
+		case isIdentStart(c) && (i == 0 || !isIdentChar(sql[i-1])):
+			end := wordEnd(sql, i)
+			word := sql[i:end]
+
+			if rules.batchSeparator != "" {
+				if count, ok := batchSeparator(sql, i, end); ok && strings.EqualFold(word, rules.batchSeparator) {
+					added := len(statements)
+					add(i)
+
+					for ; added < len(statements) && count > 1; count-- {
+						statements = append(statements, statements[added])
+					}
+
+					i = lineEnd(sql, end)
+					start = i
+
+					continue
+				}
+			} else {
+				end = trackBlock(sql, word, i, end, &depth)
+			}
+
+			hasCode = true
+			i = end
+		default:
+			if !isSpace(c) {
+				hasCode = true
+			}
+
+			i++
+		}
+	}
+
+	add(len(sql))
+
+	return statements
+}
+
+// trackBlock changes depth on keywords of blocks and returns the end of the keyword, including the word after END.
+// Keyword starts at start and ends at end.
+func trackBlock(sql, word string, start, end int, depth *int) int {
+	switch strings.ToUpper(word) {
+	case "BEGIN":
+		if beginsBlock(sql, start, end) {
+			*depth++
+		}
+	case "CASE":
+		*depth++
+	case "END":
+		if isColumnName(sql, start) {
+			return end
+		}
+
+		next := nextWord(sql, end)
+		switch strings.ToUpper(next) {
+		case "IF", "LOOP", "WHILE", "REPEAT", "FOR":
+			// Closing statements which do not open a block.
+			return end
+		case "CASE":
+			// END CASE closes the CASE statement, CASE should not open another block.
+			end = strings.Index(sql[end:], next) + end + len(next)
+		}
+
+		if *depth > 0 {
+			*depth--
+		}
+	}
+
+	return end
+}
+
+// beginsBlock reports whether BEGIN between start and end opens a block,
+// not a transaction like `BEGIN;` or `BEGIN TRANSACTION` and not a column named begin.
+func beginsBlock(sql string, start, end int) bool {
+	if isColumnName(sql, start) {
+		return false
+	}
+
+	// Column in expressions and lists, like `begin = 1` or `(begin, id)`.
+	if next := strings.TrimLeft(sql[end:], " \t\r\n\f\v"); next != "" && strings.IndexByte(",).=<>!", next[0]) >= 0 {
+		return false
+	}
+
+	switch strings.ToUpper(nextWord(sql, end)) {
+	// Transactions, `BEGIN;` has no next word.
+	case "", "TRANSACTION", "WORK", "TRAN", "DEFERRED", "IMMEDIATE", "EXCLUSIVE", "ISOLATION", "READ", "DISTRIBUTED":
+		return false
+	// Column in expressions, like `SELECT begin FROM t` or `WHERE begin IS NULL`.
+	case "FROM", "AS", "IS", "IN", "AND", "OR", "LIKE", "BETWEEN":
+		return false
+	}
+
+	switch strings.ToUpper(prevWord(sql, start)) {
+	// Column in lists and definitions, like `SELECT begin, end` or `ALTER TABLE t ADD begin date`.
+	case "SELECT", "DISTINCT", "ADD", "COLUMN", "BY", "SET", "WHERE", "AND", "OR", "ON", "RETURNING":
+		return false
+	}
+
+	return true
+}
+
+// isColumnName reports whether the keyword at start follows a list or a qualifier,
+// like `(begin int, end int)` or `t.end`, so it is a column name.
+func isColumnName(sql string, start int) bool {
+	prev := strings.TrimRight(sql[:start], " \t\r\n\f\v")
+
+	return prev != "" && strings.IndexByte(",(.", prev[len(prev)-1]) >= 0
+}
+
+// prevWord returns the word before whitespace at i, empty if the previous character does not end a word.
+func prevWord(sql string, i int) string {
+	for i > 0 && isSpace(sql[i-1]) {
+		i--
+	}
+
+	start := i
+	for start > 0 && isIdentChar(sql[start-1]) {
+		start--
+	}
+
+	return sql[start:i]
+}
+
+// nextWord returns the word after whitespace from i, empty if the next character does not start a word.
+func nextWord(sql string, i int) string {
+	for i < len(sql) && isSpace(sql[i]) {
+		i++
+	}
+
+	if i == len(sql) || !isIdentStart(sql[i]) {
+		return ""
+	}
+
+	return sql[i:wordEnd(sql, i)]
+}
+
+// batchSeparator reports whether the word between start and end is alone on its line, optionally with a count,
+// and returns the count, 1 without it. A count below 1 is not a separator.
+func batchSeparator(sql string, start, end int) (int, bool) {
+	lineStart := strings.LastIndexByte(sql[:start], '\n') + 1
+	if strings.TrimSpace(sql[lineStart:start]) != "" {
+		return 0, false
+	}
+
+	rest := strings.TrimSpace(sql[end:lineEnd(sql, end)])
+	if rest == "" {
+		return 1, true
+	}
+
+	count, err := strconv.Atoi(rest)
+	if err != nil || count < 1 || strings.Trim(rest, "0123456789") != "" {
+		return 0, false
+	}
+
+	return count, true
+}
+
+// skipComment returns the end of the comment at i, or i if no comment starts there.
+func skipComment(sql string, i int, rules splitRules) int {
+	switch {
+	case strings.HasPrefix(sql[i:], "--"), sql[i] == '#' && rules.hashComments:
+		return lineEnd(sql, i)
+	case strings.HasPrefix(sql[i:], "/*"):
+		return skipBlockComment(sql, i, rules.nestedComments)
+	}
+
+	return i
+}
+
+// skipString returns the end of the string literal at i, or i if no string starts there.
+// Strings are quoted with single quotes, dollar-quoted in PostgreSQL and also quoted with double quotes in MySQL.
+func skipString(sql string, i int, rules splitRules) int {
+	switch c := sql[i]; {
+	case c == '\'':
+		escapes := rules.backslashEscapes || rules.dollarQuotes && i > 0 && (sql[i-1] == 'E' || sql[i-1] == 'e') && (i < 2 || !isIdentChar(sql[i-2]))
+
+		return skipQuoted(sql, i, '\'', escapes)
+	case c == '"' && rules.backslashEscapes:
+		return skipQuoted(sql, i, '"', true)
+	case c == '$' && rules.dollarQuotes && (i == 0 || !isIdentChar(sql[i-1])):
+		return skipDollarQuoted(sql, i)
+	}
+
+	return i
+}
+
+func skipQuoted(sql string, i int, quote byte, escapes bool) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case escapes && sql[j] == '\\':
+			j++
+		case sql[j] == quote:
+			// Doubled quote is an escaped quote.
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+
+				continue
+			}
+
+			return j + 1
+		}
+	}
+
+	return len(sql)
+}
+
+func skipBlockComment(sql string, i int, nested bool) int {
+	depth := 0
+
+	for j := i; j < len(sql)-1; j++ {
+		switch {
+		case sql[j] == '/' && sql[j+1] == '*':
+			if depth == 0 || nested {
+				depth++
+			}
+
+			j++
+		case sql[j] == '*' && sql[j+1] == '/':
+			depth--
+			j++
+
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+
+	return len(sql)
+}
+
+// skipDollarQuoted skips the dollar-quoted string at i, returns i if the dollar does not start a tag, like `$1`.
+func skipDollarQuoted(sql string, i int) int {
+	j := i + 1
+	if j < len(sql) && isIdentStart(sql[j]) {
+		for j < len(sql) && isIdentChar(sql[j]) && sql[j] != '$' {
+			j++
+		}
+	}
+
+	if j == len(sql) || sql[j] != '$' {
+		return i
+	}
+
+	tag := sql[i : j+1]
+
+	end := strings.Index(sql[j+1:], tag)
+	if end < 0 {
+		return len(sql)
+	}
+
+	return j + 1 + end + len(tag)
+}
+
+func lineEnd(sql string, i int) int {
+	end := strings.IndexByte(sql[i:], '\n')
+	if end < 0 {
+		return len(sql)
+	}
+
+	return i + end
+}
+
+func wordEnd(sql string, i int) int {
+	for i < len(sql) && isIdentChar(sql[i]) {
+		i++
+	}
+
+	return i
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || '0' <= c && c <= '9' || c == '$'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
@@ -0,0 +1,203 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestDialect_SplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect StatementSplitter
+		sql     string
+		want    []string
+	}{
+		{
+			name:    "semicolons and comments",
+			dialect: PostgreSQLDialect{},
+			sql: `-- create; tables
+CREATE TABLE a (id int); /* comment; /* nested; */ still comment; */
+INSERT INTO a VALUES (1);
+-- trailing comment;
+`,
+			want: []string{
+				"-- create; tables\nCREATE TABLE a (id int)",
+				"/* comment; /* nested; */ still comment; */\nINSERT INTO a VALUES (1)",
+			},
+		},
+		{
+			name:    "postgresql quotes",
+			dialect: PostgreSQLDialect{},
+			sql: `INSERT INTO a VALUES ('x;''y', E'z\';', "col;");
+CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+  PERFORM 1; RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+DO $$ BEGIN RAISE NOTICE 'a;'; END $$;
+SELECT $1`,
+			want: []string{
+				`INSERT INTO a VALUES ('x;''y', E'z\';', "col;")`,
+				"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  PERFORM 1; RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql",
+				"DO $$ BEGIN RAISE NOTICE 'a;'; END $$",
+				"SELECT $1",
+			},
+		},
+		{
+			name:    "postgresql atomic body and transaction",
+			dialect: PostgreSQLDialect{},
+			sql: `BEGIN;
+CREATE FUNCTION one() RETURNS int LANGUAGE SQL BEGIN ATOMIC SELECT 1; SELECT CASE WHEN true THEN 1 END; END;
+COMMIT;`,
+			want: []string{
+				"BEGIN",
+				"CREATE FUNCTION one() RETURNS int LANGUAGE SQL BEGIN ATOMIC SELECT 1; SELECT CASE WHEN true THEN 1 END; END",
+				"COMMIT",
+			},
+		},
+		{
+			name:    "mysql procedure",
+			dialect: MySQLDialect{},
+			sql:     "# hash comment;\nCREATE PROCEDURE p() BEGIN\n  IF 1 THEN SELECT 'a\\';'; END IF;\n  CASE x WHEN 1 THEN SELECT 1; END CASE;\nEND;\nSELECT `a;b` FROM t;",
+			want: []string{
+				"# hash comment;\nCREATE PROCEDURE p() BEGIN\n  IF 1 THEN SELECT 'a\\';'; END IF;\n  CASE x WHEN 1 THEN SELECT 1; END CASE;\nEND",
+				"SELECT `a;b` FROM t",
+			},
+		},
+		{
+			name:    "sqlite trigger",
+			dialect: SQLiteDialect{},
+			sql: `CREATE TRIGGER t AFTER INSERT ON a BEGIN
+  INSERT INTO b VALUES (NEW.id);
+END;
+BEGIN TRANSACTION;
+SELECT [a;b] FROM a;`,
+			want: []string{
+				"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  INSERT INTO b VALUES (NEW.id);\nEND",
+				"BEGIN TRANSACTION",
+				"SELECT [a;b] FROM a",
+			},
+		},
+		{
+			name:    "standard sql of custom dialect",
+			dialect: dialectDefaults{customDialect{}},
+			sql:     "INSERT INTO a VALUES ('x;''y', 'z\\');\nSELECT $$a;$$;",
+			want: []string{
+				"INSERT INTO a VALUES ('x;''y', 'z\\')",
+				"SELECT $$a",
+				"$$",
+			},
+		},
+		{
+			name:    "sqlserver batches",
+			dialect: SQLServerDialect{},
+			sql: `CREATE TABLE a (id int); INSERT INTO a VALUES (1);
+GO
+CREATE PROCEDURE p AS
+BEGIN
+  SELECT 'GO'; -- GO
+END
+go
+INSERT INTO a VALUES (2)
+GO 2
+SELECT good FROM [GO]
+GO 0
+`,
+			want: []string{
+				"CREATE TABLE a (id int); INSERT INTO a VALUES (1);",
+				"CREATE PROCEDURE p AS\nBEGIN\n  SELECT 'GO'; -- GO\nEND",
+				"INSERT INTO a VALUES (2)",
+				"INSERT INTO a VALUES (2)",
+				"SELECT good FROM [GO]\nGO 0",
+			},
+		},
+		{
+			name:    "columns named begin and end",
+			dialect: PostgreSQLDialect{},
+			sql: `CREATE TABLE t (id int, begin date, end date);
+SELECT begin, end FROM t WHERE begin IS NOT NULL AND t.end > begin;
+SELECT (CASE WHEN begin IS NULL THEN 0 ELSE 1 END), id FROM t;
+ALTER TABLE t ADD begin_at date;
+`,
+			want: []string{
+				"CREATE TABLE t (id int, begin date, end date)",
+				"SELECT begin, end FROM t WHERE begin IS NOT NULL AND t.end > begin",
+				"SELECT (CASE WHEN begin IS NULL THEN 0 ELSE 1 END), id FROM t",
+				"ALTER TABLE t ADD begin_at date",
+			},
+		},
+		{
+			name:    "mysql column named begin",
+			dialect: MySQLDialect{},
+			sql:     "CREATE TABLE t (begin int);\nSELECT begin FROM t;\nUPDATE t SET begin = 1;",
+			want: []string{
+				"CREATE TABLE t (begin int)",
+				"SELECT begin FROM t",
+				"UPDATE t SET begin = 1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statements := tt.dialect.SplitStatements(tt.sql)
+
+			texts := make([]string, 0, len(statements))
+			for _, statement := range statements {
+				assert.Equal(t, statement.Text, tt.sql[statement.Offset:statement.Offset+len(statement.Text)])
+				texts = append(texts, statement.Text)
+			}
+
+			assert.Equal(t, tt.want, texts)
+		})
+	}
+}
+
+func TestMigrator_MigrateMultiple_SplitStatements(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx: db,
+		Cnf: &Config{
+			MigrationsDir:   testdata.Path("split"),
+			MigrationTable:  "migration",
+			SplitStatements: true,
+		},
+		Logger: logz.AdapterNoop{},
+	}
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectExec("^CREATE TABLE accounts \\( id serial PRIMARY KEY, name text \\)$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("^INSERT INTO accounts\\(name\\) VALUES \\('a;b'\\), \\('c'\\)$").WillReturnResult(sqlmock.NewResult(0, 2))
+	mck.ExpectExec("^UPDATE accounts SET name = upper\\(name\\)$").WillReturnResult(sqlmock.NewResult(0, 2))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	// Leading comments stay in the statement, the position is in the failed statement.
+	mck.ExpectExec("^-- Adds email with a unique constraint. ALTER TABLE accounts ADD COLUMN email text$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("^ALTER TABLE accounts ADD CONSTRAINT").
+		WillReturnError(&pgconn.PgError{Severity: "ERROR", Code: "42703", Message: `column "mail" does not exist`, Position: 58})
+
+	_, err = m.MigrateMultiple(context.Background(), []string{"1_create_accounts.sql", "2_add_email.sql"}, 0)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	var migrationErr *MigrationError
+	require.ErrorAs(t, err, &migrationErr)
+	assert.Equal(t, "ALTER TABLE accounts ADD CONSTRAINT email_unique UNIQUE (mail)", migrationErr.Statement)
+	assert.Equal(t, 3, migrationErr.Line)
+	assert.Equal(t, 58, migrationErr.Column)
+
+	require.Len(t, m.records, 1)
+	require.Len(t, m.files, 1)
+	assert.Equal(t, int64(4), m.files[0].RowsAffected)
+}
@@ -0,0 +1,334 @@
+package igmigrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// MigrationRecord is a single row of the migration table.
+//
+// Columns added after v2 are empty for versions applied before them.
+type MigrationRecord struct {
+	Path    string
+	Version int
+	// MigratedOn is set by the database, it is only filled when read from the migration table.
+	MigratedOn time.Time
+	// Checksum is empty for versions applied without checksum.
+	Checksum string
+	// File and Name are empty for versions applied without the file name.
+	File string
+	Name string
+	// Duration is the execution time of the migration, stored in milliseconds.
+	Duration time.Duration
+	// AppliedBy is the database user which applied the migration.
+	AppliedBy string
+	// Hostname is the host or pod name of the process which applied the migration.
+	Hostname string
+	// AppVersion is Config.AppVersion of the application which applied the migration.
+	AppVersion string
+}
+
+// details returns the recorded file, duration, user, host and app version, empty for versions applied without them.
+func (r MigrationRecord) details() string {
+	var sb strings.Builder
+
+	if r.Name != "" {
+		fmt.Fprintf(&sb, "\t%s %s", r.Name, r.Duration)
+	}
+
+	if r.AppliedBy != "" {
+		fmt.Fprintf(&sb, " by %s", r.AppliedBy)
+	}
+
+	if r.Hostname != "" {
+		fmt.Fprintf(&sb, " on %s", r.Hostname)
+	}
+
+	if r.AppVersion != "" {
+		fmt.Fprintf(&sb, " app %s", r.AppVersion)
+	}
+
+	return sb.String()
+}
+
+// MigrationStatus holds applied and pending migrations of all directories.
+type MigrationStatus struct {
+	// Dirs are in the same order as they would be migrated.
+	Dirs []DirStatus
+	// Orphaned are applied versions of directories which do not exist in the migrations directory.
+	Orphaned []MigrationRecord
+	// Upgrade is the pending layout upgrade of the migration table, nil if it is up to date or not created.
+	// Applied versions only have Path, Version and MigratedOn before the upgrade.
+	Upgrade *LayoutUpgrade
+}
+
+// DirStatus holds applied and pending migrations of a single directory.
+type DirStatus struct {
+	Path           string
+	CurrentVersion int
+	Applied        []MigrationRecord
+	Pending        []PlannedMigration
+	// Orphaned are applied versions without migration file.
+	Orphaned []MigrationRecord
+}
+
+// Status returns applied versions, pending files and orphaned versions for every directory.
+//
+// Migration table is not created if it does not exist, the transaction is always rolled back.
+func Status(ctx context.Context, db DB, cnf *Config) (*MigrationStatus, error) {
+	var status *MigrationStatus
+
+	err := inReadTx(ctx, db, func(tx Transaction) error {
+		var err error
+		status, err = StatusInTx(ctx, tx, cnf)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// StatusInTx is the same as Status but operates on the given transaction.
+func StatusInTx(ctx context.Context, tx Transaction, cnf *Config) (*MigrationStatus, error) {
+	migration, err := newMigrator(ctx, tx, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	tableExists, upgrade, err := migration.checkMigrationTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := migration.GetDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	var history []MigrationRecord
+
+	switch {
+	case !tableExists:
+	case upgrade != nil && upgrade.From < 4:
+		// Columns of History are added in layout version 4.
+		if history, err = migration.appliedRecords(ctx); err != nil {
+			return nil, err
+		}
+	default:
+		if history, err = migration.History(ctx, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	historyByPath := make(map[string][]MigrationRecord)
+	for _, record := range history {
+		historyByPath[record.Path] = append(historyByPath[record.Path], record)
+	}
+
+	status := &MigrationStatus{Dirs: make([]DirStatus, 0, len(dirs)), Upgrade: upgrade}
+	for _, dir := range dirs {
+		lastVersion, migrations, err := migration.pendingMigrations(ctx, dir, tableExists)
+		if err != nil {
+			return nil, err
+		}
+
+		files, err := migration.GetMigrationFiles(path.Join(migration.Cnf.MigrationsDir, dir), -1)
+		if err != nil {
+			return nil, err
+		}
+
+		fileVersions := make(map[int]struct{}, len(files))
+		for _, file := range files {
+			fileVersions[VersionFromFile(file)] = struct{}{}
+		}
+
+		dirStatus := DirStatus{
+			Path:           dir,
+			CurrentVersion: lastVersion,
+			Applied:        historyByPath[dir],
+			Pending:        make([]PlannedMigration, 0, len(migrations)),
+		}
+
+		for _, record := range dirStatus.Applied {
+			if _, ok := fileVersions[record.Version]; !ok {
+				dirStatus.Orphaned = append(dirStatus.Orphaned, record)
+			}
+		}
+
+		for _, file := range migrations {
+			dirStatus.Pending = append(dirStatus.Pending, PlannedMigration{File: file, Name: path.Base(file), Version: VersionFromFile(path.Base(file))})
+		}
+
+		status.Dirs = append(status.Dirs, dirStatus)
+
+		delete(historyByPath, dir)
+	}
+
+	for _, record := range history {
+		if _, ok := historyByPath[record.Path]; ok {
+			status.Orphaned = append(status.Orphaned, record)
+		}
+	}
+
+	return status, nil
+}
+
+// History returns rows of the migration table ordered by path and version.
+// If directoryPath is empty, rows of all directories are returned.
+//
+// Migration table must have the latest layout, otherwise error wrapping ErrUpgradeRequired is returned.
+func (m *Migrator) History(ctx context.Context, directoryPath string) ([]MigrationRecord, error) {
+	if err := m.upgradeRequired(MetadataVersion()); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT path, version, migrated_on, checksum, file, duration_ms, applied_by, hostname, app_version FROM " + m.MigrationTable()
+	args := []any{}
+
+	if directoryPath != "" {
+		query += " WHERE path = " + m.Dialect().Placeholder(1)
+		args = append(args, directoryPath)
+	}
+
+	rows, err := m.Tx.QueryContext(ctx, query+" ORDER BY path, version", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []MigrationRecord
+	for rows.Next() {
+		var (
+			record                                          MigrationRecord
+			migratedOn                                      textTime
+			checksum, file, appliedBy, hostname, appVersion sql.NullString
+			duration                                        sql.NullInt64
+		)
+
+		if err := rows.Scan(&record.Path, &record.Version, &migratedOn, &checksum,
+			&file, &duration, &appliedBy, &hostname, &appVersion); err != nil {
+			return nil, err
+		}
+
+		record.MigratedOn = migratedOn.Time
+		record.Checksum = checksum.String
+		if file.Valid {
+			record.File, record.Name = path.Join(record.Path, file.String), file.String
+		}
+		record.Duration = time.Duration(duration.Int64) * time.Millisecond
+		record.AppliedBy = appliedBy.String
+		record.Hostname = hostname.String
+		record.AppVersion = appVersion.String
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// textTimeLayouts are timestamp formats of drivers returning text, like MySQL without `parseTime=true` or SQLite.
+var textTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+}
+
+// textTime scans timestamps of drivers returning time.Time and of drivers returning text.
+// Text without time zone is read as UTC.
+type textTime struct {
+	time.Time
+}
+
+func (t *textTime) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		t.Time = v
+
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	case nil:
+		t.Time = time.Time{}
+
+		return nil
+	}
+
+	return fmt.Errorf("cannot scan %T into time", src)
+}
+
+func (t *textTime) parse(value string) error {
+	for _, layout := range textTimeLayouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			t.Time = parsed
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("cannot parse time %q", value)
+}
+
+// appliedRecords returns path, version and time of all rows of the migration table ordered by path and version,
+// columns which exist in all layouts read by Status.
+func (m *Migrator) appliedRecords(ctx context.Context) ([]MigrationRecord, error) {
+	rows, err := m.Tx.QueryContext(ctx, "SELECT path, version, migrated_on FROM "+m.MigrationTable()+" ORDER BY path, version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []MigrationRecord
+	for rows.Next() {
+		var (
+			record     MigrationRecord
+			migratedOn textTime
+		)
+
+		if err := rows.Scan(&record.Path, &record.Version, &migratedOn); err != nil {
+			return nil, err
+		}
+
+		record.MigratedOn = migratedOn.Time
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// String returns human readable status.
+func (s *MigrationStatus) String() string {
+	var sb strings.Builder
+
+	writeUpgrade(&sb, s.Upgrade)
+
+	for _, dir := range s.Dirs {
+		fmt.Fprintf(&sb, "%s: version %d, %d applied, %d pending\n", dir.Path, dir.CurrentVersion, len(dir.Applied), len(dir.Pending))
+
+		for _, record := range dir.Applied {
+			fmt.Fprintf(&sb, "  applied  %d\t%s%s\n", record.Version, record.MigratedOn.Format(time.RFC3339), record.details())
+		}
+
+		for _, file := range dir.Pending {
+			fmt.Fprintf(&sb, "  pending  %d\t%s\n", file.Version, file.File)
+		}
+
+		for _, record := range dir.Orphaned {
+			fmt.Fprintf(&sb, "  orphaned %d\tno migration file\n", record.Version)
+		}
+	}
+
+	for _, record := range s.Orphaned {
+		fmt.Fprintf(&sb, "orphaned %s version %d: directory does not exist\n", record.Path, record.Version)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,147 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestStatus(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	migratedOn := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectMigrationTable(mck, "migration")
+	mck.ExpectQuery("SELECT path, version, migrated_on, checksum, file, duration_ms, applied_by, hostname, app_version FROM migration ORDER BY path, version").
+		WillReturnRows(sqlmock.NewRows([]string{"path", "version", "migrated_on", "checksum", "file", "duration_ms", "applied_by", "hostname", "app_version"}).
+			AddRow("/", 1, migratedOn, "abc", "1_install_table.sql", 1500, "migrator", "pod-1", "v1.2.0").
+			// MySQL without parseTime and SQLite drivers return text.
+			AddRow("/", 2, []byte("2024-01-02 03:04:05"), nil, nil, nil, nil, nil, nil).
+			AddRow("/", 4, "2024-01-02T03:04:05Z", nil, nil, nil, nil, nil, nil).
+			AddRow("/removed", 1, migratedOn, nil, nil, nil, nil, nil, nil))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(4)))
+	mck.ExpectRollback()
+
+	// Version 3 is below the current version, it is reported by Validate not as pending.
+	status, err := Status(context.Background(), db, &Config{MigrationsDir: testdata.Path("normal")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, &MigrationStatus{
+		Dirs: []DirStatus{
+			{
+				Path:           "/",
+				CurrentVersion: 4,
+				Applied: []MigrationRecord{
+					{
+						Path: "/", Version: 1, MigratedOn: migratedOn, Checksum: "abc",
+						File: "/1_install_table.sql", Name: "1_install_table.sql", Duration: 1500 * time.Millisecond, AppliedBy: "migrator", Hostname: "pod-1", AppVersion: "v1.2.0",
+					},
+					{Path: "/", Version: 2, MigratedOn: migratedOn},
+					{Path: "/", Version: 4, MigratedOn: migratedOn},
+				},
+				Pending: []PlannedMigration{},
+				Orphaned: []MigrationRecord{
+					{Path: "/", Version: 4, MigratedOn: migratedOn},
+				},
+			},
+		},
+		Orphaned: []MigrationRecord{
+			{Path: "/removed", Version: 1, MigratedOn: migratedOn},
+		},
+	}, status)
+
+	assert.Equal(t, `/: version 4, 3 applied, 0 pending
+  applied  1	2024-01-02T03:04:05Z	1_install_table.sql 1.5s by migrator on pod-1 app v1.2.0
+  applied  2	2024-01-02T03:04:05Z
+  applied  4	2024-01-02T03:04:05Z
+  orphaned 4	no migration file
+orphaned /removed version 1: directory does not exist
+`, status.String())
+}
+
+func TestStatus_OlderLayout(t *testing.T) {
+	migratedOn := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		init func(mck sqlmock.Sqlmock)
+		want int
+	}{
+		{
+			name: "without metadata table",
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT to_regclass\\('migration_metadata'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mck.ExpectQuery("SELECT EXISTS .* column_name = 'path'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mck.ExpectQuery("SELECT EXISTS .* column_name = 'checksum'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			want: 2,
+		},
+		{
+			name: "older layout",
+			init: func(mck sqlmock.Sqlmock) {
+				mck.ExpectQuery("SELECT to_regclass\\('migration_metadata'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+			},
+			want: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mck, err := sqlmock.New()
+			require.NoError(t, err)
+
+			defer db.Close()
+
+			mck.MatchExpectationsInOrder(true)
+			mck.ExpectBegin()
+			mck.ExpectQuery("SELECT to_regclass\\('migration'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			tt.init(mck)
+			mck.ExpectQuery("SELECT path, version, migrated_on FROM migration ORDER BY path, version").
+				WillReturnRows(sqlmock.NewRows([]string{"path", "version", "migrated_on"}).AddRow("/", 1, migratedOn))
+			mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(1)))
+			mck.ExpectRollback()
+
+			status, err := Status(context.Background(), db, &Config{MigrationsDir: testdata.Path("normal")})
+			require.NoError(t, err)
+			require.NoError(t, mck.ExpectationsWereMet())
+
+			assert.Equal(t, &LayoutUpgrade{Table: "migration", From: tt.want, To: MetadataVersion()}, status.Upgrade)
+			assert.Equal(t, []MigrationRecord{{Path: "/", Version: 1, MigratedOn: migratedOn}}, status.Dirs[0].Applied)
+			assert.Len(t, status.Dirs[0].Pending, 2)
+		})
+	}
+}
+
+func TestStatus_UpgradeRequired(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	// Table of the first release has no path column.
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	mck.ExpectQuery("SELECT to_regclass\\('migration'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mck.ExpectQuery("SELECT to_regclass\\('migration_metadata'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mck.ExpectQuery("SELECT EXISTS .* column_name = 'path'").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mck.ExpectRollback()
+
+	_, err = Status(context.Background(), db, &Config{MigrationsDir: testdata.Path("normal")})
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.ErrorIs(t, err, ErrUpgradeRequired)
+	assert.EqualError(t, err, "migration table migration needs upgrade from layout version 1 to 4, run Migrate first")
+}
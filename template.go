@@ -0,0 +1,156 @@
+package igmigrator
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// TemplateSuffix is added to `.sql` migration files rendered as Go templates before running,
+// like `5_partitions.sql.tmpl` or `5_partitions.down.sql.tmpl`.
+const TemplateSuffix = ".tmpl"
+
+// maxIncludeDepth limits nested includes of templates, to stop a template including itself.
+const maxIncludeDepth = 10
+
+// TemplateData is the data of migration file templates.
+type TemplateData struct {
+	// Values are Config.Values, like `{{ .Values.tenant }}`.
+	Values map[string]string
+	// Schema is Config.Schema.
+	Schema string
+	// Path is the directory of the migration, like `/` or `/test`.
+	Path    string
+	File    string
+	Name    string
+	Version int
+}
+
+// isSQLFile reports whether the file is a SQL migration file or its template.
+func isSQLFile(name string) bool {
+	return strings.HasSuffix(name, ".sql") || isTemplate(name)
+}
+
+// isDownMigrationFile reports whether the file is a down migration file or its template.
+func isDownMigrationFile(name string) bool {
+	return strings.HasSuffix(name, DownMigrationSuffix) || strings.HasSuffix(name, DownMigrationSuffix+TemplateSuffix)
+}
+
+// isTemplate reports whether the file is rendered as Go template.
+func isTemplate(name string) bool {
+	return strings.HasSuffix(name, ".sql"+TemplateSuffix)
+}
+
+// render returns the SQL of the template file.
+func (m *Migrator) render(filePath string, content []byte) (string, error) {
+	fileName := path.Base(filePath)
+
+	data := TemplateData{
+		Values:  m.Cnf.Values,
+		Schema:  m.Cnf.Schema,
+		Path:    m.relativeDir(path.Dir(filePath)),
+		File:    path.Join(m.relativeDir(path.Dir(filePath)), fileName),
+		Name:    fileName,
+		Version: VersionFromFile(fileName),
+	}
+
+	return m.renderTemplate(filePath, string(content), data, 0)
+}
+
+// renderTemplate renders content of the file, includes are relative to the directory of the file
+// and cannot be outside of the migrations directory.
+func (m *Migrator) renderTemplate(filePath, content string, data TemplateData, depth int) (string, error) {
+	if depth > maxIncludeDepth {
+		return "", fmt.Errorf("include of %s exceeds depth %d", filePath, maxIncludeDepth)
+	}
+
+	dialect := m.dialectWithDefaults()
+
+	funcs := template.FuncMap{
+		"quoteIdent": func(parts ...string) string {
+			return quoteIdent(dialect, parts...)
+		},
+		"quoteLiteral": func(value string) string {
+			return dialect.QuoteLiteral(value)
+		},
+		"env":   env,
+		"split": split,
+		"include": func(name string) (string, error) {
+			includePath := path.Join(path.Dir(filePath), name)
+			if !m.inMigrationsDir(includePath) {
+				return "", fmt.Errorf("include %s is outside of the migrations directory", name)
+			}
+
+			included, err := m.readFile(includePath)
+			if err != nil {
+				return "", err
+			}
+
+			return m.renderTemplate(includePath, string(included), data, depth+1)
+		},
+	}
+
+	tmpl, err := template.New(path.Base(filePath)).Option("missingkey=error").Funcs(funcs).Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// inMigrationsDir reports whether the file path is in the migrations directory.
+func (m *Migrator) inMigrationsDir(filePath string) bool {
+	dir := path.Clean(m.Cnf.MigrationsDir)
+	filePath = path.Clean(filePath)
+
+	if dir == "." {
+		return filePath != ".." && !strings.HasPrefix(filePath, "../")
+	}
+
+	return strings.HasPrefix(filePath, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// quoteIdent quotes parts of a name with the dialect and joins them with dots, like `"schema"."table"`.
+func quoteIdent(q Quoter, parts ...string) string {
+	quoted := make([]string, 0, len(parts))
+	for _, part := range parts {
+		quoted = append(quoted, q.QuoteIdent(part))
+	}
+
+	return strings.Join(quoted, ".")
+}
+
+// env returns the environment variable, or the default value if it is not set.
+// Without default value, a not set variable is an error.
+func env(key string, defaultValue ...string) (string, error) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, nil
+	}
+
+	if len(defaultValue) > 0 {
+		return defaultValue[0], nil
+	}
+
+	return "", fmt.Errorf("environment variable %q is not set", key)
+}
+
+// split returns trimmed items of s separated by sep, like `{{ range split .Values.tenants "," }}`.
+func split(s, sep string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+
+	items := strings.Split(s, sep)
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+
+	return items
+}
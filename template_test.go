@@ -0,0 +1,223 @@
+package igmigrator
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+const renderedTenants = `-- Schema of each tenant.
+CREATE SCHEMA IF NOT EXISTS "tenant_a";
+CREATE SCHEMA IF NOT EXISTS "tenant_b";
+INSERT INTO settings(name, value) VALUES ('debug', 'it''s on');
+GRANT USAGE ON SCHEMA "public" TO "app";
+
+`
+
+func TestMigrator_GetMigrationFiles_Template(t *testing.T) {
+	m := Migrator{Cnf: &Config{MigrationsDir: testdata.Path("template")}}
+
+	files, err := m.GetMigrationFiles(testdata.Path("template"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_create_tenants.sql.tmpl", "2_add_column.sql"}, files)
+
+	down, err := m.GetDownMigrationFile(testdata.Path("template"), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "2_add_column.down.sql.tmpl", down)
+}
+
+func TestMigrator_Render(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		dialect Dialect
+		values  map[string]string
+		env     map[string]string
+		want    string
+		err     string
+	}{
+		{
+			name:   "file",
+			file:   "1_create_tenants.sql.tmpl",
+			values: map[string]string{"tenants": "a, b", "owner": "app"},
+			want:   renderedTenants,
+		},
+		{
+			name:    "data",
+			content: "-- {{ .Path }} {{ .File }} {{ .Name }} {{ .Version }}",
+			want:    "-- / /5_test.sql.tmpl 5_test.sql.tmpl 5",
+		},
+		{
+			name:    "environment",
+			content: `{{ if eq (env "IGMIGRATOR_TEST_ENV") "prod" }}SELECT 1{{ end }}`,
+			env:     map[string]string{"IGMIGRATOR_TEST_ENV": "prod"},
+			want:    "SELECT 1",
+		},
+		{
+			name:    "mysql quotes",
+			content: `SELECT {{ quoteLiteral "a\\'b" }} FROM {{ quoteIdent "db" "t` + "`" + `" }}`,
+			dialect: MySQLDialect{},
+			want:    "SELECT 'a\\\\''b' FROM `db`.`t```",
+		},
+		{
+			name:    "sqlserver quotes",
+			content: `SELECT * FROM {{ quoteIdent "dbo" "a]b" }}`,
+			dialect: SQLServerDialect{},
+			want:    "SELECT * FROM [dbo].[a]]b]",
+		},
+		{
+			name:    "custom dialect quotes",
+			content: `SELECT {{ quoteLiteral "a\\'b" }} FROM {{ quoteIdent "t\"" }}`,
+			dialect: customDialect{},
+			want:    `SELECT 'a\''b' FROM "t"""`,
+		},
+		{
+			name:    "missing value",
+			content: "SELECT {{ .Values.column }}",
+			values:  map[string]string{},
+			err:     `template: 5_test.sql.tmpl:1:17: executing "5_test.sql.tmpl" at <.Values.column>: map has no entry for key "column"`,
+		},
+		{
+			name:    "environment not set",
+			content: `SELECT {{ env "IGMIGRATOR_TEST_NOT_SET" }}`,
+			err:     `template: 5_test.sql.tmpl:1:10: executing "5_test.sql.tmpl" at <env "IGMIGRATOR_TEST_NOT_SET">: error calling env: environment variable "IGMIGRATOR_TEST_NOT_SET" is not set`,
+		},
+		{
+			name:    "include outside of migrations directory",
+			content: `{{ include "../locking/1_install_table.sql" }}`,
+			err:     "include ../locking/1_install_table.sql is outside of the migrations directory",
+		},
+		{
+			name:    "recursive include",
+			content: `{{ include "recursive.inc" }}`,
+			err:     "include of testdata/template/recursive.inc exceeds depth 10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			m := Migrator{Cnf: &Config{
+				MigrationsDir: testdata.Path("template"),
+				Schema:        "public",
+				Values:        tt.values,
+				Dialect:       tt.dialect,
+			}}
+
+			filePath := testdata.Path("template", "5_test.sql.tmpl")
+			content := []byte(tt.content)
+
+			if tt.file != "" {
+				filePath = testdata.Path("template", tt.file)
+
+				var err error
+				content, err = os.ReadFile(filePath)
+				require.NoError(t, err)
+			}
+
+			rendered, err := m.render(filePath, content)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rendered)
+		})
+	}
+}
+
+func TestMigrator_MigrateMultiple_Template(t *testing.T) {
+	db, mck, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx: db,
+		Cnf: &Config{
+			MigrationsDir:  testdata.Path("template"),
+			MigrationTable: "migration",
+			Schema:         "public",
+			Values:         map[string]string{"tenants": "a, b", "owner": "app"},
+		},
+		Logger: logz.AdapterNoop{},
+	}
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectExec(renderedTenants).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectCurrentUser(mck)
+	// Checksum is of the rendered SQL, not of the template.
+	mck.ExpectExec("INSERT INTO public.migration(path, version, checksum, file, duration_ms, applied_by, hostname, app_version) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)").
+		WithArgs(recordArgs("/", 1, checksum([]byte(renderedTenants)))...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	version, err := m.MigrateMultiple(context.Background(), []string{"1_create_tenants.sql.tmpl"}, 0)
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+	assert.Equal(t, 1, version)
+}
+
+func TestPlan_Template(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.ExpectBegin()
+	mck.ExpectExec("set local search_path = public").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectMigrationTable(mck, "public.migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM public.migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectRollback()
+
+	plan, err := Plan(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("template"),
+		Schema:        "public",
+		Values:        map[string]string{"tenants": "a, b", "owner": "app"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, renderedTenants, plan.Dirs[0].Files[0].Rendered)
+	assert.Empty(t, plan.Dirs[0].Files[1].Rendered)
+	assert.Equal(t, `/: 0 -> 2
+  1	/1_create_tenants.sql.tmpl
+    | -- Schema of each tenant.
+    | CREATE SCHEMA IF NOT EXISTS "tenant_a";
+    | CREATE SCHEMA IF NOT EXISTS "tenant_b";
+    | INSERT INTO settings(name, value) VALUES ('debug', 'it''s on');
+    | GRANT USAGE ON SCHEMA "public" TO "app";
+  2	/2_add_column.sql
+`, plan.String())
+}
+
+func TestMigrator_ContentChecksum_Template(t *testing.T) {
+	filePath := testdata.Path("template", "1_create_tenants.sql.tmpl")
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+
+	checksumOf := func(values map[string]string) string {
+		m := Migrator{Cnf: &Config{MigrationsDir: testdata.Path("template"), Schema: "public", Values: values}}
+
+		fileChecksum, err := m.contentChecksum(filePath, content)
+		require.NoError(t, err)
+
+		return fileChecksum
+	}
+
+	// Same template renders different SQL with other values.
+	assert.NotEqual(t, checksumOf(map[string]string{"tenants": "a", "owner": "app"}), checksumOf(map[string]string{"tenants": "a, b", "owner": "app"}))
+	assert.Equal(t, checksum([]byte(renderedTenants)), checksumOf(map[string]string{"tenants": "a, b", "owner": "app"}))
+}
@@ -0,0 +1 @@
+CREATE TABLE accounts (id SERIAL PRIMARY KEY);
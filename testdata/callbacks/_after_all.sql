@@ -0,0 +1 @@
+GRANT SELECT ON ALL TABLES IN SCHEMA public TO reader;
@@ -0,0 +1 @@
+INSERT INTO audit (event) VALUES ('migrated');
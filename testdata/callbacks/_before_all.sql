@@ -0,0 +1 @@
+SET LOCAL role migrator;
@@ -0,0 +1,3 @@
+CREATE TABLE accounts (
+	user_id serial PRIMARY KEY
+);
@@ -35,6 +35,10 @@ func (t *TransactionMock) QueryRowContext(ctx context.Context, query string, arg
 	panic("implement me")
 }
 
+func (t *TransactionMock) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	panic("implement me")
+}
+
 func (t *TransactionMock) Commit() error {
 	panic("implement me")
 }
@@ -0,0 +1,4 @@
+CREATE TABLE accounts (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL
+);
@@ -0,0 +1,2 @@
+-- igmigrator:no-transaction
+DROP INDEX CONCURRENTLY accounts_email_idx;
@@ -0,0 +1,3 @@
+-- Index is built without locking accounts for writes.
+-- igmigrator:no-transaction
+CREATE INDEX CONCURRENTLY accounts_email_idx ON accounts (email);
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN name VARCHAR(255);
@@ -0,0 +1,5 @@
+CREATE TABLE ${TABLE} (
+    id serial PRIMARY KEY,
+    name ${TYPE} NOT NULL andd,
+    note text
+);
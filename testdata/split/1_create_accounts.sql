@@ -0,0 +1,7 @@
+CREATE TABLE accounts (
+    id serial PRIMARY KEY,
+    name text
+);
+
+INSERT INTO accounts(name) VALUES ('a;b'), ('c');
+UPDATE accounts SET name = upper(name);
@@ -0,0 +1,3 @@
+-- Adds email with a unique constraint.
+ALTER TABLE accounts ADD COLUMN email text;
+ALTER TABLE accounts ADD CONSTRAINT email_unique UNIQUE (mail);
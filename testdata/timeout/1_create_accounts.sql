@@ -0,0 +1,4 @@
+CREATE TABLE accounts (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255)
+);
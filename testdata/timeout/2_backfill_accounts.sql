@@ -0,0 +1,3 @@
+-- Backfill takes longer than other migrations.
+-- igmigrator:statement-timeout 10m
+UPDATE accounts SET name = 'unknown' WHERE name IS NULL;
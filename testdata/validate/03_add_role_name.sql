@@ -0,0 +1 @@
+ALTER TABLE roles ADD COLUMN name TEXT;
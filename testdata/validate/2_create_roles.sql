@@ -0,0 +1,3 @@
+CREATE TABLE roles (
+	id serial PRIMARY KEY
+);
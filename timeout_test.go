@@ -0,0 +1,133 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestMigrateInTx_StatementTimeout(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("SET LOCAL statement_timeout = '30000ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE accounts").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("SET LOCAL statement_timeout = DEFAULT").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 1, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+	// Directive of the file overrides the configuration.
+	mck.ExpectExec("SET LOCAL statement_timeout = '600000ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("UPDATE accounts SET name").WillReturnResult(sqlmock.NewResult(0, 3))
+	mck.ExpectExec("SET LOCAL statement_timeout = DEFAULT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	result, err := MigrateInTx(context.Background(), db, &Config{
+		MigrationsDir:    testdata.Path("timeout"),
+		StatementTimeout: 30 * time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 0, NewVersion: 2}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	require.Len(t, result.Records, 2)
+	require.Len(t, result.Files, 2)
+	assert.Equal(t, "/1_create_accounts.sql", result.Files[0].File)
+	assert.Equal(t, int64(0), result.Files[0].RowsAffected)
+	assert.Equal(t, 2, result.Files[1].Version)
+	assert.Equal(t, int64(3), result.Files[1].RowsAffected)
+	assert.Equal(t, result.Records[1].Checksum, result.Files[1].Checksum)
+}
+
+func TestMigrate_MaxDuration(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	// Remaining duration is used as statement timeout.
+	mck.ExpectExec("SET LOCAL statement_timeout = '\\d+ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE accounts").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectRollback()
+
+	_, err = Migrate(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		MaxDuration:   50 * time.Millisecond,
+	})
+	require.ErrorIs(t, err, ErrMaxDuration)
+	assert.ErrorContains(t, err, "failed migration on testdata/locking/1_install_table.sql version 1")
+	// Transaction is rolled back in background when the context is done.
+	assert.Eventually(t, func() bool { return mck.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+}
+
+func TestMigrate_CallerDeadline(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(nil))
+	mck.ExpectExec("SET LOCAL statement_timeout = '\\d+ms'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectExec("CREATE TABLE accounts").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 0))
+	mck.ExpectRollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = Migrate(ctx, db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		MaxDuration:   time.Hour,
+	})
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrMaxDuration)
+	assert.ErrorContains(t, err, "failed migration on testdata/locking/1_install_table.sql version 1")
+	assert.Eventually(t, func() bool { return mck.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+}
+
+func TestMigrate_MaxDurationInHook(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectPrepareDB(mck, "migration")
+	mck.ExpectRollback()
+
+	_, err = Migrate(context.Background(), db, &Config{
+		MigrationsDir: testdata.Path("locking"),
+		MaxDuration:   50 * time.Millisecond,
+		BeforeAll: func(ctx context.Context, _ Transaction) error {
+			<-ctx.Done()
+
+			return ctx.Err()
+		},
+	})
+	require.ErrorIs(t, err, ErrMaxDuration)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Eventually(t, func() bool { return mck.ExpectationsWereMet() == nil }, time.Second, 10*time.Millisecond)
+}
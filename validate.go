@@ -0,0 +1,259 @@
+package igmigrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// IssueKind is the type of a validation issue.
+type IssueKind string
+
+const (
+	// IssueOutOfOrder is a not applied migration file with a version below the current version.
+	IssueOutOfOrder IssueKind = "out_of_order"
+	// IssueDuplicateVersion is a version used by more than one migration file.
+	IssueDuplicateVersion IssueKind = "duplicate_version"
+	// IssueMissingFile is an applied version without migration file.
+	IssueMissingFile IssueKind = "missing_file"
+	// IssueChecksumMismatch is an applied migration file changed after it was applied.
+	IssueChecksumMismatch IssueKind = "checksum_mismatch"
+)
+
+// ValidationIssue is a single difference between migration files and migration table.
+type ValidationIssue struct {
+	Kind IssueKind
+	// Path is the directory of the migration, like `/` or `/test`.
+	Path    string
+	Version int
+	// Files are related migration files relative to the migrations directory, empty for IssueMissingFile.
+	Files   []string
+	Message string
+}
+
+// ValidationReport holds all issues found by Validate.
+type ValidationReport struct {
+	Issues []ValidationIssue
+	// Upgrade is the pending layout upgrade of the migration table, nil if it is up to date or not created.
+	// Checksums are not compared before the upgrade adds their column.
+	Upgrade *LayoutUpgrade
+}
+
+// HasIssues reports whether any issue is found.
+func (r *ValidationReport) HasIssues() bool {
+	return len(r.Issues) > 0
+}
+
+// Err returns issues as a joined error, nil without issues.
+// Checksum mismatches match ErrChecksumMismatch and missing files match ErrMissingFile with errors.Is.
+func (r *ValidationReport) Err() error {
+	errs := make([]error, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		errs = append(errs, issue.err())
+	}
+
+	return errors.Join(errs...)
+}
+
+// err returns the issue as error matching the sentinel error of its kind.
+func (i ValidationIssue) err() error {
+	switch i.Kind {
+	case IssueChecksumMismatch:
+		return &sentinelError{message: i.Message, sentinel: ErrChecksumMismatch}
+	case IssueMissingFile:
+		return &sentinelError{message: i.Message, sentinel: ErrMissingFile}
+	default:
+		return errors.New(i.Message)
+	}
+}
+
+// String returns issues line by line.
+func (r *ValidationReport) String() string {
+	var sb strings.Builder
+
+	writeUpgrade(&sb, r.Upgrade)
+
+	for _, issue := range r.Issues {
+		fmt.Fprintf(&sb, "%s: %s\n", issue.Kind, issue.Message)
+	}
+
+	return sb.String()
+}
+
+// Validate compares migration files with the migration table without running any migration.
+//
+// It reports not applied files below the current version, duplicate versions,
+// applied versions without file and changed applied files.
+func Validate(ctx context.Context, db DB, cnf *Config) (*ValidationReport, error) {
+	var report *ValidationReport
+
+	err := inReadTx(ctx, db, func(tx Transaction) error {
+		var err error
+		report, err = ValidateInTx(ctx, tx, cnf)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ValidateInTx is the same as Validate but operates on the given transaction.
+func ValidateInTx(ctx context.Context, tx Transaction, cnf *Config) (*ValidationReport, error) {
+	migration, err := newMigrator(ctx, tx, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	tableExists, upgrade, err := migration.checkMigrationTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, err := migration.GetDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ValidationReport{Upgrade: upgrade}
+	for _, dir := range dirs {
+		issues, err := migration.validateDir(ctx, dir, tableExists)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Issues = append(report.Issues, issues...)
+	}
+
+	return report, nil
+}
+
+// validateDir returns issues of a single directory.
+// If tableExists is false, only migration files are checked.
+func (m *Migrator) validateDir(ctx context.Context, dir string, tableExists bool) ([]ValidationIssue, error) {
+	files, err := m.GetMigrationFiles(path.Join(m.Cnf.MigrationsDir, dir), -1)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []ValidationIssue
+
+	filesByVersion := make(map[int][]string, len(files))
+	for _, file := range files {
+		version := VersionFromFile(file)
+		filesByVersion[version] = append(filesByVersion[version], path.Join(dir, file))
+	}
+
+	for i, file := range files {
+		version := VersionFromFile(file)
+		if i > 0 && VersionFromFile(files[i-1]) == version {
+			continue
+		}
+
+		if duplicates := filesByVersion[version]; len(duplicates) > 1 {
+			issues = append(issues, ValidationIssue{
+				Kind:    IssueDuplicateVersion,
+				Path:    dir,
+				Version: version,
+				Files:   duplicates,
+				Message: fmt.Sprintf("version %d of %s is used by multiple files: %s", version, dir, strings.Join(duplicates, ", ")),
+			})
+		}
+	}
+
+	if !tableExists {
+		return issues, nil
+	}
+
+	applied, err := m.GetAppliedVersions(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedSet := make(map[int]struct{}, len(applied))
+	for _, version := range applied {
+		appliedSet[version] = struct{}{}
+
+		if _, ok := filesByVersion[version]; !ok {
+			issues = append(issues, ValidationIssue{
+				Kind:    IssueMissingFile,
+				Path:    dir,
+				Version: version,
+				Message: fmt.Sprintf("applied version %d of %s has no migration file", version, dir),
+			})
+		}
+	}
+
+	if len(applied) > 0 {
+		lastVersion := applied[len(applied)-1]
+		for _, file := range files {
+			version := VersionFromFile(file)
+			if version >= lastVersion {
+				break
+			}
+
+			if _, ok := appliedSet[version]; !ok {
+				filePath := path.Join(dir, file)
+				issues = append(issues, ValidationIssue{
+					Kind:    IssueOutOfOrder,
+					Path:    dir,
+					Version: version,
+					Files:   []string{filePath},
+					Message: fmt.Sprintf("%s version %d is not applied but current version is %d", filePath, version, lastVersion),
+				})
+			}
+		}
+	}
+
+	// Checksum column is added in layout version 3.
+	if !m.hasLayout(3) {
+		return issues, nil
+	}
+
+	mismatches, err := m.VerifyChecksums(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mismatch := range mismatches {
+		issues = append(issues, ValidationIssue{
+			Kind:    IssueChecksumMismatch,
+			Path:    dir,
+			Version: mismatch.Version,
+			Files:   []string{mismatch.File},
+			Message: mismatch.String(),
+		})
+	}
+
+	return issues, nil
+}
+
+// checkDir validates the directory before migration.
+//
+// Duplicate versions always fail, out of order files fail without Config.AllowOutOfOrder,
+// changed files fail without Config.WarnChecksumMismatch and missing files are only logged.
+func (m *Migrator) checkDir(ctx context.Context, dir string) error {
+	issues, err := m.validateDir(ctx, dir, true)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, issue := range issues {
+		switch {
+		case issue.Kind == IssueMissingFile,
+			issue.Kind == IssueChecksumMismatch && m.Cnf.WarnChecksumMismatch:
+			m.Logger.Warn(issue.Message, "path", issue.Path, "version", issue.Version, "issue", string(issue.Kind))
+		case issue.Kind == IssueOutOfOrder && m.Cnf.AllowOutOfOrder:
+			m.Logger.Info("applying out of order migration", "path", issue.Path, "version", issue.Version, "files", issue.Files)
+		default:
+			errs = append(errs, issue.err())
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,149 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestValidate(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	expectMigrationTable(mck, "migration")
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3).AddRow(5))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectRollback()
+
+	report, err := Validate(context.Background(), db, &Config{MigrationsDir: testdata.Path("validate")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.True(t, report.HasIssues())
+	assert.Equal(t, []ValidationIssue{
+		{
+			Kind:    IssueDuplicateVersion,
+			Path:    "/",
+			Version: 3,
+			Files:   []string{"/03_add_role_name.sql", "/3_add_user_name.sql"},
+			Message: "version 3 of / is used by multiple files: /03_add_role_name.sql, /3_add_user_name.sql",
+		},
+		{
+			Kind:    IssueMissingFile,
+			Path:    "/",
+			Version: 5,
+			Message: "applied version 5 of / has no migration file",
+		},
+		{
+			Kind:    IssueOutOfOrder,
+			Path:    "/",
+			Version: 2,
+			Files:   []string{"/2_create_roles.sql"},
+			Message: "/2_create_roles.sql version 2 is not applied but current version is 5",
+		},
+	}, report.Issues)
+	assert.ErrorIs(t, report.Err(), ErrMissingFile)
+	assert.NotErrorIs(t, report.Err(), ErrChecksumMismatch)
+}
+
+func TestMigrate_AllowOutOfOrder(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx:     db,
+		Cnf:    &Config{MigrationsDir: testdata.Path("normal"), MigrationTable: "migration"},
+		Logger: logz.AdapterNoop{},
+	}
+
+	expectDir := func() {
+		mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3))
+		mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").
+			WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	}
+
+	expectDir()
+	assert.EqualError(t, m.checkDir(context.Background(), "/"), "/2_install_pos.sql version 2 is not applied but current version is 3")
+
+	m.Cnf.AllowOutOfOrder = true
+
+	expectDir()
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(3)))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3))
+	mck.ExpectExec("create table  IF NOT EXISTS latest").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	prev, current, err := migrateInTxDir(context.Background(), &m, "/", false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, prev)
+	assert.Equal(t, 3, current)
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestMigrateTo_AllowOutOfOrder(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	mck.MatchExpectationsInOrder(true)
+	expectPrepareDB(mck, "migration")
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(3)))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3))
+	mck.ExpectQuery("SELECT version, checksum FROM migration WHERE path = \\$1 AND checksum IS NOT NULL").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version", "checksum"}))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(int64(3)))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3))
+	mck.ExpectExec("create table  IF NOT EXISTS latest").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectCurrentUser(mck)
+	mck.ExpectExec("INSERT INTO migration\\(path, version, checksum, file, duration_ms, applied_by, hostname, app_version\\)").WithArgs(recordArgs("/", 2, sqlmock.AnyArg())...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	result, err := MigrateToInTx(context.Background(), db, &Config{MigrationsDir: testdata.Path("normal"), AllowOutOfOrder: true}, "/", 3)
+	require.NoError(t, err)
+	assert.Equal(t, MigrateResultVersion{PrevVersion: 3, NewVersion: 3}, result.Path["/"])
+	require.NoError(t, mck.ExpectationsWereMet())
+}
+
+func TestValidate_OlderLayout(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	// Checksums are not compared before the upgrade adds their column.
+	mck.MatchExpectationsInOrder(true)
+	mck.ExpectBegin()
+	mck.ExpectQuery("SELECT to_regclass\\('migration'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mck.ExpectQuery("SELECT to_regclass\\('migration_metadata'\\) IS NOT NULL").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mck.ExpectQuery("SELECT MAX\\(version\\) FROM migration_metadata").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mck.ExpectQuery("SELECT version FROM migration WHERE path = \\$1 ORDER BY version").WithArgs("/").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(3))
+	mck.ExpectRollback()
+
+	report, err := Validate(context.Background(), db, &Config{MigrationsDir: testdata.Path("normal")})
+	require.NoError(t, err)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	assert.Equal(t, &LayoutUpgrade{Table: "migration", From: 2, To: MetadataVersion()}, report.Upgrade)
+	require.Len(t, report.Issues, 1)
+	assert.Equal(t, IssueOutOfOrder, report.Issues[0].Kind)
+	assert.Equal(t, "migration table migration needs upgrade from layout version 2 to 4\nout_of_order: /2_install_pos.sql version 2 is not applied but current version is 3\n", report.String())
+}
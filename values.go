@@ -0,0 +1,117 @@
+package igmigrator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expand replaces variables like `${name}` and `${name:-default}` with values and records the replaced variables.
+//
+// Comments and string literals of the dialect syntax, including dollar-quoted bodies, are kept as they are.
+// Variables not in values and without default value return an error wrapping ErrUndefinedVariable.
+func expand(s string, rules splitRules, values map[string]string) (expansion, error) {
+	var (
+		sb           strings.Builder
+		replacements []replacement
+	)
+
+	last := 0
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "${") {
+			v, err := parseVariable(s, i)
+			if err != nil {
+				return expansion{}, err
+			}
+
+			value, ok := values[v.name]
+			if !ok {
+				if !v.hasDefault {
+					line, column := lineColumn(s, i)
+
+					return expansion{}, fmt.Errorf("%w %q at line %d, column %d", ErrUndefinedVariable, v.name, line, column)
+				}
+
+				value = v.defaultValue
+			}
+
+			sb.WriteString(s[last:i])
+			replacements = append(replacements, replacement{
+				offset:         sb.Len(),
+				length:         len(value),
+				originalOffset: i,
+				originalLength: v.end - i,
+			})
+			sb.WriteString(value)
+
+			i, last = v.end, v.end
+
+			continue
+		}
+
+		if end := skipComment(s, i, rules); end > i {
+			i = end
+
+			continue
+		}
+
+		if end := skipString(s, i, rules); end > i {
+			i = end
+
+			continue
+		}
+
+		i++
+	}
+
+	if len(replacements) == 0 {
+		return expansion{text: s}, nil
+	}
+
+	sb.WriteString(s[last:])
+
+	return expansion{text: sb.String(), replacements: replacements}, nil
+}
+
+// variable is a variable in a migration file, like `${name}` or `${name:-default}`.
+type variable struct {
+	name         string
+	defaultValue string
+	hasDefault   bool
+	// end is the byte offset after the closing brace.
+	end int
+}
+
+// parseVariable parses the variable starting at i.
+func parseVariable(s string, i int) (variable, error) {
+	closing := strings.IndexByte(s[i:], '}')
+	if closing < 0 {
+		line, column := lineColumn(s, i)
+
+		return variable{}, fmt.Errorf("unclosed variable at line %d, column %d", line, column)
+	}
+
+	name, defaultValue, hasDefault := strings.Cut(s[i+2:i+closing], ":-")
+	if !isVariableName(name) {
+		line, column := lineColumn(s, i)
+
+		return variable{}, fmt.Errorf("invalid variable name %q at line %d, column %d", name, line, column)
+	}
+
+	return variable{name: name, defaultValue: defaultValue, hasDefault: hasDefault, end: i + closing + 1}, nil
+}
+
+// isVariableName reports whether name has only letters, digits and underscores, not starting with a digit.
+func isVariableName(name string) bool {
+	if name == "" || '0' <= name[0] && name[0] <= '9' {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '_' && !('0' <= c && c <= '9') && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,139 @@
+package igmigrator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/worldline-go/logz"
+
+	"github.com/worldline-go/igmigrator/v2/testdata"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		rules    splitRules
+		values   map[string]string
+		want     string
+		offsets  map[int]int
+		replaced int
+		err      string
+	}{
+		{
+			name:    "no variables",
+			text:    "SELECT 1",
+			want:    "SELECT 1",
+			offsets: map[int]int{0: 0, 7: 7},
+		},
+		{
+			name:   "longer value",
+			text:   "SELECT ${A} FROM t",
+			values: map[string]string{"A": "column_name"},
+			want:   "SELECT column_name FROM t",
+			// Inside the value points to the variable, after it is shifted back.
+			offsets:  map[int]int{7: 7, 12: 7, 19: 12},
+			replaced: 1,
+		},
+		{
+			name:     "shorter value",
+			text:     "SELECT ${COLUMN}, ${B} FROM t",
+			values:   map[string]string{"COLUMN": "c", "B": "b"},
+			want:     "SELECT c, b FROM t",
+			offsets:  map[int]int{8: 16, 10: 18, 12: 23},
+			replaced: 2,
+		},
+		{
+			name:     "default value",
+			text:     `CREATE TABLE "${SCHEMA:-public}".t_${SUFFIX:-} (${COLUMN:-id} int)`,
+			values:   map[string]string{"COLUMN": "key"},
+			want:     `CREATE TABLE "public".t_ (key int)`,
+			replaced: 3,
+		},
+		{
+			name:  "postgresql literals",
+			text:  "SELECT '${A}', E'\\'${A}', $1, $$ ${A} $$, $body$ ${A} $body$, \"${A}\" -- ${A}\n/* /* ${A} */ ${A} */",
+			rules: PostgreSQLDialect{}.syntax(),
+			// Variables in literals and comments are kept.
+			values:   map[string]string{"A": "a"},
+			want:     "SELECT '${A}', E'\\'${A}', $1, $$ ${A} $$, $body$ ${A} $body$, \"a\" -- ${A}\n/* /* ${A} */ ${A} */",
+			replaced: 1,
+		},
+		{
+			name:     "mysql literals",
+			text:     "SELECT \"${A}\", '\\'${A}', `${A}` # ${A}",
+			rules:    MySQLDialect{}.syntax(),
+			values:   map[string]string{"A": "a"},
+			want:     "SELECT \"${A}\", '\\'${A}', `a` # ${A}",
+			replaced: 1,
+		},
+		{
+			name: "undefined variable in literal",
+			text: "INSERT INTO t VALUES ('${A}')",
+			want: "INSERT INTO t VALUES ('${A}')",
+		},
+		{
+			name: "undefined variable",
+			text: "SELECT 1;\nSELECT ${A} FROM ${TABLE}",
+			values: map[string]string{
+				"A": "a",
+			},
+			err: `undefined variable "TABLE" at line 2, column 18`,
+		},
+		{
+			name: "unclosed variable",
+			text: "SELECT ${A",
+			err:  "unclosed variable at line 1, column 8",
+		},
+		{
+			name: "invalid name",
+			text: "SELECT ${1A}",
+			err:  `invalid variable name "1A" at line 1, column 8`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expanded, err := expand(tt.text, tt.rules, tt.values)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expanded.text)
+			assert.Len(t, expanded.replacements, tt.replaced)
+
+			for offset, want := range tt.offsets {
+				assert.Equal(t, want, expanded.originalOffset(offset), "offset %d", offset)
+			}
+		})
+	}
+}
+
+func TestMigrator_MigrateMultiple_UndefinedVariable(t *testing.T) {
+	db, mck, err := sqlmock.New()
+	require.NoError(t, err)
+
+	defer db.Close()
+
+	m := Migrator{
+		Tx: db,
+		Cnf: &Config{
+			MigrationsDir:  testdata.Path("position"),
+			MigrationTable: "migration",
+			Values:         map[string]string{"TABLE": "accounts_archive"},
+		},
+		Logger: logz.AdapterNoop{},
+	}
+
+	_, err = m.MigrateMultiple(context.Background(), []string{"1_create_table.sql"}, 0)
+	require.NoError(t, mck.ExpectationsWereMet())
+
+	require.ErrorIs(t, err, ErrUndefinedVariable)
+	assert.EqualError(t, err, `failed migration on testdata/position/1_create_table.sql version 1: undefined variable "TYPE" at line 3, column 10`)
+}